@@ -1,37 +1,62 @@
 package main
 
 import (
-	_ "embed"
+	"context"
+	"database/sql"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/ilya2044/avito2025/internal/api"
+	"github.com/ilya2044/avito2025/internal/migrations"
 	"github.com/ilya2044/avito2025/internal/service"
 	"github.com/ilya2044/avito2025/internal/storage"
 )
 
-var migrationSQL string
-
 func main() {
 	flag.Parse()
-	db, err := storage.NewDBFromEnv()
+	switch flag.Arg(0) {
+	case "migrate":
+		if err := runMigrate(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "user-token":
+		if err := printUserToken(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	store, err := newStore()
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err := db.Ping(); err != nil {
+	drainDelay, err := envDuration("SHUTDOWN_DELAY", 2*time.Second)
+	if err != nil {
 		log.Fatal(err)
 	}
-	repo := storage.NewRepository(db)
-	if err := repo.ApplyMigrations(migrationSQL); err != nil {
-		log.Fatal("migration failed:", err)
+	drainTimeout, err := envDuration("SHUTDOWN_TIMEOUT", 5*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	svc := service.NewService(store)
+	if v := os.Getenv("ASSIGN_SEED"); v != "" {
+		seed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			log.Fatalf("bad ASSIGN_SEED %q: %v", v, err)
+		}
+		svc.Seeds = service.NewSeeder(seed)
 	}
-	svc := service.NewService(repo)
 	h := api.NewHandler(svc)
+	h.AdminToken = os.Getenv("ADMIN_TOKEN")
+	h.UserTokenSecret = os.Getenv("USER_TOKEN_SECRET")
 	r := mux.NewRouter()
 	h.RegisterRoutes(r)
 	port := os.Getenv("PORT")
@@ -44,8 +69,167 @@ func main() {
 		WriteTimeout: 5 * time.Second,
 		ReadTimeout:  5 * time.Second,
 	}
-	fmt.Println("listening on", srv.Addr)
-	if err := srv.ListenAndServe(); err != nil {
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() {
+		fmt.Println("listening on", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
 		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	// Fail readiness first and give the load balancer time to notice,
+	// then stop accepting connections and wait for in-flight requests.
+	log.Printf("shutting down: draining for %s", drainDelay)
+	h.StartDraining()
+	time.Sleep(drainDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		log.Printf("closing storage: %v", err)
+	}
+	log.Println("stopped")
+}
+
+// envDuration reads a Go duration such as "5s" from the environment.
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s %q: %w", key, v, err)
+	}
+	return d, nil
+}
+
+// newStore picks the storage backend from DB_DRIVER: "postgres" (default),
+// "sqlite" or "memory". SQL backends are migrated up before use.
+func newStore() (storage.Store, error) {
+	driver := os.Getenv("DB_DRIVER")
+	if driver == "memory" {
+		return storage.NewMemoryStore(), nil
+	}
+	db, dialect, err := openDB(driver)
+	if err != nil {
+		return nil, err
+	}
+	runner, err := migrations.NewRunner(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		return nil, fmt.Errorf("migration failed: %w", err)
+	}
+	timeout, err := storage.QueryTimeoutFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	repo := storage.NewRepository(db)
+	if dialect == migrations.SQLite {
+		repo = storage.NewSQLiteRepository(db)
+	}
+	repo.QueryTimeout = timeout
+	return repo, nil
+}
+
+func openDB(driver string) (*sql.DB, string, error) {
+	switch driver {
+	case "", "postgres":
+		db, err := storage.NewDBFromEnv()
+		if err != nil {
+			return nil, "", err
+		}
+		if err := db.Ping(); err != nil {
+			return nil, "", err
+		}
+		return db, migrations.Postgres, nil
+	case "sqlite":
+		db, err := storage.NewSQLiteDBFromEnv()
+		if err != nil {
+			return nil, "", err
+		}
+		return db, migrations.SQLite, nil
+	default:
+		return nil, "", fmt.Errorf("unknown DB_DRIVER %q", driver)
+	}
+}
+
+// printUserToken implements "user-token <user_id>": it prints the
+// X-User-Token value for the user under USER_TOKEN_SECRET.
+func printUserToken(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: user-token <user_id>")
+	}
+	secret := os.Getenv("USER_TOKEN_SECRET")
+	if secret == "" {
+		return fmt.Errorf("USER_TOKEN_SECRET is not set")
+	}
+	fmt.Println(api.UserToken(secret, args[0]))
+	return nil
+}
+
+// runMigrate implements "migrate status|up|down [n]". down rolls back one
+// migration unless n is given.
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate status|up|down [n]")
+	}
+	db, dialect, err := openDB(os.Getenv("DB_DRIVER"))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	runner, err := migrations.NewRunner(db, dialect)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "status":
+		list, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range list {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", st.Version, st.Name, state)
+		}
+	case "up":
+		applied, err := runner.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Println("applied:", applied)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("bad number of steps %q", args[1])
+			}
+		}
+		reverted, err := runner.Down(ctx, n)
+		if err != nil {
+			return err
+		}
+		fmt.Println("reverted:", reverted)
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
 	}
+	return nil
 }
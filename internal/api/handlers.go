@@ -1,17 +1,36 @@
 package api
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
+	"strings"
+	"sync/atomic"
 
 	"github.com/gorilla/mux"
 	"github.com/ilya2044/avito2025/internal/model"
 	"github.com/ilya2044/avito2025/internal/service"
+	"github.com/ilya2044/avito2025/internal/storage"
 )
 
 type Handler struct {
 	Svc *service.Service
+	// AdminToken is compared with the X-Admin-Token header on admin-only
+	// actions. Empty disables them.
+	AdminToken string
+	// UserTokenSecret signs the per-user tokens checked in the
+	// X-User-Token header, see UserToken. Empty leaves only the admin
+	// token for actions taken on a user's behalf.
+	UserTokenSecret string
+	// draining is set once shutdown has started; /ready then fails so the
+	// load balancer stops sending traffic.
+	draining atomic.Bool
 }
 
 func NewHandler(svc *service.Service) *Handler {
@@ -31,18 +50,50 @@ func writeJSON(w http.ResponseWriter, code int, v interface{}) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
+// writeOtherError reports an error no case of the handler matched: a
+// missing pull request, user or team is NOT_FOUND, a change that kept
+// losing to concurrent ones is CONFLICT and anything else INTERNAL.
+func writeOtherError(w http.ResponseWriter, err error) {
+	er := ErrResp{}
+	er.Error.Message = err.Error()
+	switch {
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, service.ErrUserNotFound), errors.Is(err, service.ErrTeamNotFound):
+		er.Error.Code = "NOT_FOUND"
+		writeJSON(w, 404, er)
+	case errors.Is(err, storage.ErrStatusConflict), errors.Is(err, storage.ErrRotationConflict):
+		er.Error.Code = "CONFLICT"
+		writeJSON(w, 409, er)
+	default:
+		er.Error.Code = "INTERNAL"
+		writeJSON(w, 500, er)
+	}
+}
+
 func (h *Handler) AddTeam(w http.ResponseWriter, r *http.Request) {
-	var t model.Team
+	// settings is decoded like /team/setSettings, so fields left out
+	// keep their defaults.
+	var req struct {
+		TeamName string                   `json:"team_name"`
+		Members  []model.TeamMember       `json:"members"`
+		Settings model.TeamSettingsUpdate `json:"settings"`
+	}
 	body, _ := io.ReadAll(r.Body)
-	_ = json.Unmarshal(body, &t)
-	if t.TeamName == "" {
+	_ = json.Unmarshal(body, &req)
+	if req.TeamName == "" {
 		writeJSON(w, 400, map[string]string{"error": "team_name required"})
 		return
 	}
-	err := h.Svc.CreateTeam(t)
+	t := model.Team{TeamName: req.TeamName, Members: req.Members}
+	err := h.Svc.CreateTeam(r.Context(), &t, req.Settings)
 	if err != nil {
 		er := ErrResp{}
 		er.Error.Code = "TEAM_EXISTS"
+		switch {
+		case errors.Is(err, service.ErrBadSettings):
+			er.Error.Code = "INVALID_SETTINGS"
+		case errors.Is(err, service.ErrBadProfile):
+			er.Error.Code = "INVALID_PROFILE"
+		}
 		er.Error.Message = err.Error()
 		writeJSON(w, 400, er)
 		return
@@ -56,7 +107,7 @@ func (h *Handler) GetTeam(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 400, map[string]string{"error": "team_name required"})
 		return
 	}
-	t, err := h.Svc.GetTeam(q)
+	t, err := h.Svc.GetTeam(r.Context(), q)
 	if err != nil {
 		er := ErrResp{}
 		er.Error.Code = "NOT_FOUND"
@@ -67,6 +118,36 @@ func (h *Handler) GetTeam(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, 200, t)
 }
 
+func (h *Handler) SetTeamSettings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TeamName string `json:"team_name"`
+		model.TeamSettingsUpdate
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]string{"error": "invalid"})
+		return
+	}
+	if req.TeamName == "" {
+		writeJSON(w, 400, map[string]string{"error": "team_name required"})
+		return
+	}
+	settings, err := h.Svc.UpdateTeamSettings(r.Context(), req.TeamName, req.TeamSettingsUpdate)
+	if err != nil {
+		er := ErrResp{}
+		if errors.Is(err, service.ErrBadSettings) {
+			er.Error.Code = "INVALID_SETTINGS"
+			er.Error.Message = err.Error()
+			writeJSON(w, 400, er)
+			return
+		}
+		er.Error.Code = "NOT_FOUND"
+		er.Error.Message = err.Error()
+		writeJSON(w, 404, er)
+		return
+	}
+	writeJSON(w, 200, map[string]interface{}{"team_name": req.TeamName, "settings": settings})
+}
+
 func (h *Handler) SetIsActive(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		UserID   string `json:"user_id"`
@@ -77,22 +158,199 @@ func (h *Handler) SetIsActive(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 400, map[string]string{"error": "user_id required"})
 		return
 	}
-	u, err := h.Svc.SetUserIsActive(req.UserID, req.IsActive)
+	if !req.IsActive {
+		u, d, err := h.Svc.DeactivateUser(r.Context(), req.UserID)
+		if err != nil {
+			er := ErrResp{}
+			er.Error.Code = "NOT_FOUND"
+			er.Error.Message = err.Error()
+			writeJSON(w, 404, er)
+			return
+		}
+		writeJSON(w, 200, map[string]interface{}{"user": u, "reassigned": d.Reassigned, "failed": d.Failed})
+		return
+	}
+	u, err := h.Svc.SetUserIsActive(r.Context(), req.UserID, req.IsActive)
+	if err != nil {
+		er := ErrResp{}
+		er.Error.Code = "NOT_FOUND"
+		er.Error.Message = err.Error()
+		writeJSON(w, 404, er)
+		return
+	}
+	writeJSON(w, 200, map[string]model.User{"user": u})
+}
+
+// BulkDeactivate deactivates the listed users and/or a whole team and
+// reassigns their open reviews.
+func (h *Handler) BulkDeactivate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserIDs  []string `json:"user_ids"`
+		TeamName string   `json:"team_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]string{"error": "invalid"})
+		return
+	}
+	if len(req.UserIDs) == 0 && req.TeamName == "" {
+		writeJSON(w, 400, map[string]string{"error": "user_ids or team_name required"})
+		return
+	}
+	users, d, err := h.Svc.DeactivateUsers(r.Context(), req.UserIDs, req.TeamName)
+	if err != nil {
+		er := ErrResp{}
+		er.Error.Code = "NOT_FOUND"
+		er.Error.Message = err.Error()
+		writeJSON(w, 404, er)
+		return
+	}
+	writeJSON(w, 200, map[string]interface{}{"users": users, "reassigned": d.Reassigned, "failed": d.Failed})
+}
+
+func (h *Handler) GetCapacity(w http.ResponseWriter, r *http.Request) {
+	uid := r.URL.Query().Get("user_id")
+	if uid == "" {
+		writeJSON(w, 400, map[string]string{"error": "user_id required"})
+		return
+	}
+	c, err := h.Svc.GetUserCapacity(r.Context(), uid)
+	if err != nil {
+		er := ErrResp{}
+		er.Error.Code = "NOT_FOUND"
+		er.Error.Message = err.Error()
+		writeJSON(w, 404, er)
+		return
+	}
+	writeJSON(w, 200, c)
+}
+
+// SetCapacity sets max_open_reviews; null or a missing value removes the
+// limit.
+func (h *Handler) SetCapacity(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID         string `json:"user_id"`
+		MaxOpenReviews *int   `json:"max_open_reviews"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.UserID == "" {
+		writeJSON(w, 400, map[string]string{"error": "user_id required"})
+		return
+	}
+	c, err := h.Svc.SetUserCapacity(r.Context(), req.UserID, req.MaxOpenReviews)
 	if err != nil {
 		er := ErrResp{}
+		er.Error.Message = err.Error()
+		if errors.Is(err, service.ErrBadCapacity) {
+			er.Error.Code = "INVALID_CAPACITY"
+			writeJSON(w, 400, er)
+			return
+		}
 		er.Error.Code = "NOT_FOUND"
+		writeJSON(w, 404, er)
+		return
+	}
+	writeJSON(w, 200, c)
+}
+
+func (h *Handler) SetProfile(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID string   `json:"user_id"`
+		Weight *float64 `json:"weight"`
+		Tier   *string  `json:"tier"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.UserID == "" {
+		writeJSON(w, 400, map[string]string{"error": "user_id required"})
+		return
+	}
+	u, err := h.Svc.SetUserProfile(r.Context(), req.UserID, req.Weight, req.Tier)
+	if err != nil {
+		er := ErrResp{}
 		er.Error.Message = err.Error()
+		if errors.Is(err, service.ErrBadProfile) {
+			er.Error.Code = "INVALID_PROFILE"
+			writeJSON(w, 400, er)
+			return
+		}
+		er.Error.Code = "NOT_FOUND"
 		writeJSON(w, 404, er)
 		return
 	}
 	writeJSON(w, 200, map[string]model.User{"user": u})
 }
 
+func (h *Handler) AddUnavailability(w http.ResponseWriter, r *http.Request) {
+	var req model.Unavailability
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, 400, map[string]string{"error": "invalid"})
+		return
+	}
+	if req.UserID == "" {
+		writeJSON(w, 400, map[string]string{"error": "user_id required"})
+		return
+	}
+	u, err := h.Svc.AddUnavailability(r.Context(), req)
+	if err != nil {
+		er := ErrResp{}
+		er.Error.Message = err.Error()
+		if errors.Is(err, service.ErrBadPeriod) {
+			er.Error.Code = "INVALID_PERIOD"
+			writeJSON(w, 400, er)
+			return
+		}
+		er.Error.Code = "NOT_FOUND"
+		writeJSON(w, 404, er)
+		return
+	}
+	writeJSON(w, 201, map[string]model.Unavailability{"unavailability": u})
+}
+
+func (h *Handler) GetUnavailability(w http.ResponseWriter, r *http.Request) {
+	uid := r.URL.Query().Get("user_id")
+	if uid == "" {
+		writeJSON(w, 400, map[string]string{"error": "user_id required"})
+		return
+	}
+	list, err := h.Svc.ListUnavailability(r.Context(), uid)
+	if err != nil {
+		er := ErrResp{}
+		er.Error.Code = "NOT_FOUND"
+		er.Error.Message = err.Error()
+		writeJSON(w, 404, er)
+		return
+	}
+	writeJSON(w, 200, map[string]interface{}{"user_id": uid, "unavailability": list})
+}
+
+func (h *Handler) RemoveUnavailability(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID string `json:"user_id"`
+		ID     int64  `json:"id"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.UserID == "" || req.ID == 0 {
+		writeJSON(w, 400, map[string]string{"error": "user_id and id required"})
+		return
+	}
+	if err := h.Svc.RemoveUnavailability(r.Context(), req.UserID, req.ID); err != nil {
+		er := ErrResp{}
+		er.Error.Code = "NOT_FOUND"
+		er.Error.Message = err.Error()
+		writeJSON(w, 404, er)
+		return
+	}
+	writeJSON(w, 200, map[string]interface{}{"user_id": req.UserID, "id": req.ID})
+}
+
 func (h *Handler) CreatePR(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		PullRequestID   string `json:"pull_request_id"`
-		PullRequestName string `json:"pull_request_name"`
-		AuthorID        string `json:"author_id"`
+		PullRequestID   string   `json:"pull_request_id"`
+		PullRequestName string   `json:"pull_request_name"`
+		AuthorID        string   `json:"author_id"`
+		ReviewersCount  *int     `json:"reviewers_count"`
+		Draft           bool     `json:"draft"`
+		Files           []string `json:"files"`
+		Reviewers       []string `json:"reviewers"`
 	}
 	_ = json.NewDecoder(r.Body).Decode(&req)
 	if req.PullRequestID == "" || req.PullRequestName == "" || req.AuthorID == "" {
@@ -103,23 +361,31 @@ func (h *Handler) CreatePR(w http.ResponseWriter, r *http.Request) {
 		PullRequestID:   req.PullRequestID,
 		PullRequestName: req.PullRequestName,
 		AuthorID:        req.AuthorID,
+		Files:           req.Files,
 	}
-	created, err := h.Svc.CreatePullRequest(pr)
+	opts := service.CreateOptions{ReviewersCount: req.ReviewersCount, Draft: req.Draft, Reviewers: req.Reviewers}
+	created, err := h.Svc.CreatePullRequest(r.Context(), pr, opts)
 	if err != nil {
 		er := ErrResp{}
-		switch err {
-		case service.ErrPRExists:
-			er.Error.Code = "PR_EXISTS"
+		switch {
+		case errors.Is(err, service.ErrBadCount):
+			er.Error.Code = "INVALID_REVIEWERS_COUNT"
+			er.Error.Message = err.Error()
+			writeJSON(w, 400, er)
+		case errors.Is(err, service.ErrNotEnough):
+			er.Error.Code = "NOT_ENOUGH_REVIEWERS"
 			er.Error.Message = err.Error()
 			writeJSON(w, 409, er)
-		case service.ErrTeamNotFound:
-			er.Error.Code = "NOT_FOUND"
+		case errors.Is(err, service.ErrBadReviewer):
+			er.Error.Code = "INVALID_REVIEWER"
 			er.Error.Message = err.Error()
-			writeJSON(w, 404, er)
-		default:
-			er.Error.Code = "NOT_FOUND"
+			writeJSON(w, 400, er)
+		case errors.Is(err, service.ErrPRExists):
+			er.Error.Code = "PR_EXISTS"
 			er.Error.Message = err.Error()
-			writeJSON(w, 404, er)
+			writeJSON(w, 409, er)
+		default:
+			writeOtherError(w, err)
 		}
 		return
 	}
@@ -129,23 +395,182 @@ func (h *Handler) CreatePR(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) MergePR(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		PullRequestID string `json:"pull_request_id"`
+		Force         bool   `json:"force"`
 	}
 	_ = json.NewDecoder(r.Body).Decode(&req)
 	if req.PullRequestID == "" {
 		writeJSON(w, 400, map[string]string{"error": "pull_request_id required"})
 		return
 	}
-	pr, err := h.Svc.MergePullRequest(req.PullRequestID)
+	if req.Force && !h.isAdmin(r) {
+		er := ErrResp{}
+		er.Error.Code = "FORBIDDEN"
+		er.Error.Message = "force merge requires admin token"
+		writeJSON(w, 403, er)
+		return
+	}
+	pr, err := h.Svc.MergePullRequest(r.Context(), req.PullRequestID, req.Force)
 	if err != nil {
 		er := ErrResp{}
-		er.Error.Code = "NOT_FOUND"
 		er.Error.Message = err.Error()
-		writeJSON(w, 404, er)
+		switch {
+		case errors.Is(err, service.ErrNotApproved):
+			er.Error.Code = "NOT_APPROVED"
+			writeJSON(w, 409, er)
+		case errors.Is(err, service.ErrPRClosed):
+			er.Error.Code = "PR_CLOSED"
+			writeJSON(w, 409, er)
+		case errors.Is(err, service.ErrPRDraft):
+			er.Error.Code = "PR_DRAFT"
+			writeJSON(w, 409, er)
+		default:
+			writeOtherError(w, err)
+		}
+		return
+	}
+	writeJSON(w, 200, map[string]model.PullRequest{"pr": pr})
+}
+
+// ReadyPR takes a draft out of DRAFT and assigns its reviewers.
+func (h *Handler) ReadyPR(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PullRequestID  string `json:"pull_request_id"`
+		ReviewersCount *int   `json:"reviewers_count"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.PullRequestID == "" {
+		writeJSON(w, 400, map[string]string{"error": "pull_request_id required"})
+		return
+	}
+	pr, err := h.Svc.MarkReady(r.Context(), req.PullRequestID, req.ReviewersCount)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJSON(w, 200, map[string]model.PullRequest{"pr": pr})
+}
+
+func (h *Handler) ClosePR(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.PullRequestID == "" {
+		writeJSON(w, 400, map[string]string{"error": "pull_request_id required"})
+		return
+	}
+	pr, err := h.Svc.ClosePullRequest(r.Context(), req.PullRequestID)
+	if err != nil {
+		writeStatusError(w, err)
+		return
+	}
+	writeJSON(w, 200, map[string]model.PullRequest{"pr": pr})
+}
+
+func (h *Handler) ReopenPR(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.PullRequestID == "" {
+		writeJSON(w, 400, map[string]string{"error": "pull_request_id required"})
+		return
+	}
+	pr, err := h.Svc.ReopenPullRequest(r.Context(), req.PullRequestID)
+	if err != nil {
+		writeStatusError(w, err)
 		return
 	}
 	writeJSON(w, 200, map[string]model.PullRequest{"pr": pr})
 }
 
+// writeStatusError reports a failed draft/close/reopen transition.
+func writeStatusError(w http.ResponseWriter, err error) {
+	er := ErrResp{}
+	er.Error.Message = err.Error()
+	switch {
+	case errors.Is(err, service.ErrPRMerged):
+		er.Error.Code = "PR_MERGED"
+		writeJSON(w, 409, er)
+	case errors.Is(err, service.ErrPRClosed):
+		er.Error.Code = "PR_CLOSED"
+		writeJSON(w, 409, er)
+	case errors.Is(err, service.ErrBadCount):
+		er.Error.Code = "INVALID_REVIEWERS_COUNT"
+		writeJSON(w, 400, er)
+	case errors.Is(err, service.ErrNotEnough):
+		er.Error.Code = "NOT_ENOUGH_REVIEWERS"
+		writeJSON(w, 409, er)
+	default:
+		writeOtherError(w, err)
+	}
+}
+
+// reviewerRequest is the body of /pullRequest/addReviewer and
+// /pullRequest/removeReviewer.
+type reviewerRequest struct {
+	PullRequestID string `json:"pull_request_id"`
+	UserID        string `json:"user_id"`
+}
+
+func (h *Handler) AddReviewer(w http.ResponseWriter, r *http.Request) {
+	var req reviewerRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.PullRequestID == "" || req.UserID == "" {
+		writeJSON(w, 400, map[string]string{"error": "pull_request_id and user_id required"})
+		return
+	}
+	pr, err := h.Svc.AddReviewer(r.Context(), req.PullRequestID, req.UserID)
+	if err != nil {
+		writeReviewerError(w, err)
+		return
+	}
+	writeJSON(w, 200, map[string]model.PullRequest{"pr": pr})
+}
+
+func (h *Handler) RemoveReviewer(w http.ResponseWriter, r *http.Request) {
+	var req reviewerRequest
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.PullRequestID == "" || req.UserID == "" {
+		writeJSON(w, 400, map[string]string{"error": "pull_request_id and user_id required"})
+		return
+	}
+	pr, err := h.Svc.RemoveReviewer(r.Context(), req.PullRequestID, req.UserID)
+	if err != nil {
+		writeReviewerError(w, err)
+		return
+	}
+	writeJSON(w, 200, map[string]model.PullRequest{"pr": pr})
+}
+
+// writeReviewerError reports a failed manual change of reviewers.
+func writeReviewerError(w http.ResponseWriter, err error) {
+	er := ErrResp{}
+	er.Error.Message = err.Error()
+	switch {
+	case errors.Is(err, service.ErrBadReviewer):
+		er.Error.Code = "INVALID_REVIEWER"
+		writeJSON(w, 400, er)
+	case errors.Is(err, service.ErrPRMerged):
+		er.Error.Code = "PR_MERGED"
+		writeJSON(w, 409, er)
+	case errors.Is(err, service.ErrPRClosed):
+		er.Error.Code = "PR_CLOSED"
+		writeJSON(w, 409, er)
+	case errors.Is(err, service.ErrPRDraft):
+		er.Error.Code = "PR_DRAFT"
+		writeJSON(w, 409, er)
+	case errors.Is(err, service.ErrAssigned):
+		er.Error.Code = "ALREADY_ASSIGNED"
+		writeJSON(w, 409, er)
+	case errors.Is(err, service.ErrNotAssigned):
+		er.Error.Code = "NOT_ASSIGNED"
+		writeJSON(w, 409, er)
+	default:
+		writeOtherError(w, err)
+	}
+}
+
 func (h *Handler) Reassign(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		PullRequestID string `json:"pull_request_id"`
@@ -156,39 +581,166 @@ func (h *Handler) Reassign(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 400, map[string]string{"error": "invalid"})
 		return
 	}
-	pr, replacedBy, err := h.Svc.ReassignReviewer(req.PullRequestID, req.OldUserID)
+	pr, replacedBy, err := h.Svc.ReassignReviewer(r.Context(), req.PullRequestID, req.OldUserID)
 	if err != nil {
 		er := ErrResp{}
-		switch err {
-		case service.ErrPRMerged:
+		switch {
+		case errors.Is(err, service.ErrPRMerged):
 			er.Error.Code = "PR_MERGED"
 			er.Error.Message = err.Error()
 			writeJSON(w, 409, er)
-		case service.ErrNotAssigned:
+		case errors.Is(err, service.ErrPRClosed):
+			er.Error.Code = "PR_CLOSED"
+			er.Error.Message = err.Error()
+			writeJSON(w, 409, er)
+		case errors.Is(err, service.ErrPRDraft):
+			er.Error.Code = "PR_DRAFT"
+			er.Error.Message = err.Error()
+			writeJSON(w, 409, er)
+		case errors.Is(err, service.ErrNotAssigned):
 			er.Error.Code = "NOT_ASSIGNED"
 			er.Error.Message = err.Error()
 			writeJSON(w, 409, er)
-		case service.ErrNoCandidate:
+		case errors.Is(err, service.ErrNoCandidate):
 			er.Error.Code = "NO_CANDIDATE"
 			er.Error.Message = err.Error()
 			writeJSON(w, 409, er)
 		default:
-			er.Error.Code = "NOT_FOUND"
+			writeOtherError(w, err)
+		}
+		return
+	}
+	writeJSON(w, 200, map[string]interface{}{"pr": pr, "replaced_by": replacedBy})
+}
+
+func (h *Handler) Decline(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+		UserID        string `json:"user_id"`
+		Reason        string `json:"reason"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.PullRequestID == "" || req.UserID == "" || req.Reason == "" {
+		writeJSON(w, 400, map[string]string{"error": "pull_request_id, user_id and reason required"})
+		return
+	}
+	if !h.isUser(r, req.UserID) && !h.isAdmin(r) {
+		er := ErrResp{}
+		er.Error.Code = "FORBIDDEN"
+		er.Error.Message = "declining requires the reviewer's user token or the admin token"
+		writeJSON(w, 403, er)
+		return
+	}
+	pr, replacedBy, err := h.Svc.DeclineReview(r.Context(), req.PullRequestID, req.UserID, req.Reason)
+	if err != nil {
+		er := ErrResp{}
+		switch {
+		case errors.Is(err, service.ErrPRMerged):
+			er.Error.Code = "PR_MERGED"
 			er.Error.Message = err.Error()
-			writeJSON(w, 404, er)
+			writeJSON(w, 409, er)
+		case errors.Is(err, service.ErrPRClosed):
+			er.Error.Code = "PR_CLOSED"
+			er.Error.Message = err.Error()
+			writeJSON(w, 409, er)
+		case errors.Is(err, service.ErrPRDraft):
+			er.Error.Code = "PR_DRAFT"
+			er.Error.Message = err.Error()
+			writeJSON(w, 409, er)
+		case errors.Is(err, service.ErrNotAssigned):
+			er.Error.Code = "NOT_ASSIGNED"
+			er.Error.Message = err.Error()
+			writeJSON(w, 409, er)
+		default:
+			writeOtherError(w, err)
 		}
 		return
 	}
 	writeJSON(w, 200, map[string]interface{}{"pr": pr, "replaced_by": replacedBy})
 }
 
+func (h *Handler) Review(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PullRequestID string `json:"pull_request_id"`
+		UserID        string `json:"user_id"`
+		Decision      string `json:"decision"`
+		Comment       string `json:"comment"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+	if req.PullRequestID == "" || req.UserID == "" || req.Decision == "" {
+		writeJSON(w, 400, map[string]string{"error": "pull_request_id, user_id and decision required"})
+		return
+	}
+	pr, err := h.Svc.ReviewPullRequest(r.Context(), req.PullRequestID, req.UserID, req.Decision, req.Comment)
+	if err != nil {
+		er := ErrResp{}
+		er.Error.Message = err.Error()
+		switch {
+		case errors.Is(err, service.ErrBadDecision):
+			er.Error.Code = "INVALID_DECISION"
+			writeJSON(w, 400, er)
+		case errors.Is(err, service.ErrPRMerged):
+			er.Error.Code = "PR_MERGED"
+			writeJSON(w, 409, er)
+		case errors.Is(err, service.ErrPRClosed):
+			er.Error.Code = "PR_CLOSED"
+			writeJSON(w, 409, er)
+		case errors.Is(err, service.ErrPRDraft):
+			er.Error.Code = "PR_DRAFT"
+			writeJSON(w, 409, er)
+		case errors.Is(err, service.ErrNotAssigned):
+			er.Error.Code = "NOT_ASSIGNED"
+			writeJSON(w, 409, er)
+		default:
+			writeOtherError(w, err)
+		}
+		return
+	}
+	writeJSON(w, 200, map[string]model.PullRequest{"pr": pr})
+}
+
+func (h *Handler) GetDecisions(w http.ResponseWriter, r *http.Request) {
+	prID := r.URL.Query().Get("pull_request_id")
+	if prID == "" {
+		writeJSON(w, 400, map[string]string{"error": "pull_request_id required"})
+		return
+	}
+	decs, err := h.Svc.ListDecisions(r.Context(), prID)
+	if err != nil {
+		er := ErrResp{}
+		er.Error.Code = "NOT_FOUND"
+		er.Error.Message = err.Error()
+		writeJSON(w, 404, er)
+		return
+	}
+	writeJSON(w, 200, map[string]interface{}{"pull_request_id": prID, "decisions": decs})
+}
+
+func (h *Handler) ExplainPR(w http.ResponseWriter, r *http.Request) {
+	prID := r.URL.Query().Get("pull_request_id")
+	if prID == "" {
+		writeJSON(w, 400, map[string]string{"error": "pull_request_id required"})
+		return
+	}
+	ex, err := h.Svc.ExplainPullRequest(r.Context(), prID)
+	if err != nil {
+		er := ErrResp{}
+		er.Error.Code = "NOT_FOUND"
+		er.Error.Message = err.Error()
+		writeJSON(w, 404, er)
+		return
+	}
+	writeJSON(w, 200, ex)
+}
+
 func (h *Handler) GetReviews(w http.ResponseWriter, r *http.Request) {
 	uid := r.URL.Query().Get("user_id")
 	if uid == "" {
 		writeJSON(w, 400, map[string]string{"error": "user_id required"})
 		return
 	}
-	list, err := h.Svc.GetPRsByReviewer(uid)
+	list, err := h.Svc.GetPRsByReviewer(r.Context(), uid)
 	if err != nil {
 		er := ErrResp{}
 		er.Error.Code = "NOT_FOUND"
@@ -212,10 +764,13 @@ func (h *Handler) AddUserToTeam(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 400, map[string]string{"error": "team_name and user_id required"})
 		return
 	}
-	team, err := h.Svc.AddUserToTeam(req.TeamName, req.User)
+	team, err := h.Svc.AddUserToTeam(r.Context(), req.TeamName, req.User)
 	if err != nil {
 		er := ErrResp{}
 		er.Error.Code = "ERROR"
+		if errors.Is(err, service.ErrBadProfile) {
+			er.Error.Code = "INVALID_PROFILE"
+		}
 		er.Error.Message = err.Error()
 		writeJSON(w, 400, er)
 		return
@@ -236,7 +791,7 @@ func (h *Handler) RemoveUserFromTeam(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, 400, map[string]string{"error": "team_name and user_id required"})
 		return
 	}
-	team, err := h.Svc.RemoveUserFromTeam(req.TeamName, req.UserID)
+	team, err := h.Svc.RemoveUserFromTeam(r.Context(), req.TeamName, req.UserID)
 	if err != nil {
 		er := ErrResp{}
 		er.Error.Code = "ERROR"
@@ -251,16 +806,67 @@ func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, 200, map[string]string{"status": "ok"})
 }
 
+func (h *Handler) isAdmin(r *http.Request) bool {
+	token := r.Header.Get("X-Admin-Token")
+	return h.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) == 1
+}
+
+// isUser reports whether the X-User-Token header holds userID's token.
+func (h *Handler) isUser(r *http.Request, userID string) bool {
+	token := r.Header.Get("X-User-Token")
+	return h.UserTokenSecret != "" && hmac.Equal([]byte(token), []byte(UserToken(h.UserTokenSecret, userID)))
+}
+
+// UserToken returns the token that proves a request is made by userID:
+// the hex HMAC-SHA256 of the user_id under secret. The system that
+// authenticates users hands it out; "pr-reviewer user-token" prints one.
+func UserToken(secret, userID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// StartDraining makes /ready report the instance as unavailable.
+func (h *Handler) StartDraining() {
+	h.draining.Store(true)
+}
+
+func (h *Handler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		writeJSON(w, 503, map[string]string{"status": "draining"})
+		return
+	}
+	writeJSON(w, 200, map[string]string{"status": "ready"})
+}
+
 func (h *Handler) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/team/add", h.AddTeam).Methods("POST")
 	r.HandleFunc("/team/get", h.GetTeam).Methods("GET")
+	r.HandleFunc("/team/setSettings", h.SetTeamSettings).Methods("POST")
 	r.HandleFunc("/users/setIsActive", h.SetIsActive).Methods("POST")
+	r.HandleFunc("/users/bulkDeactivate", h.BulkDeactivate).Methods("POST")
+	r.HandleFunc("/users/getCapacity", h.GetCapacity).Methods("GET")
+	r.HandleFunc("/users/setCapacity", h.SetCapacity).Methods("POST")
+	r.HandleFunc("/users/setProfile", h.SetProfile).Methods("POST")
+	r.HandleFunc("/users/addUnavailability", h.AddUnavailability).Methods("POST")
+	r.HandleFunc("/users/getUnavailability", h.GetUnavailability).Methods("GET")
+	r.HandleFunc("/users/removeUnavailability", h.RemoveUnavailability).Methods("POST")
 	r.HandleFunc("/pullRequest/create", h.CreatePR).Methods("POST")
 	r.HandleFunc("/pullRequest/merge", h.MergePR).Methods("POST")
 	r.HandleFunc("/pullRequest/reassign", h.Reassign).Methods("POST")
+	r.HandleFunc("/pullRequest/decline", h.Decline).Methods("POST")
+	r.HandleFunc("/pullRequest/addReviewer", h.AddReviewer).Methods("POST")
+	r.HandleFunc("/pullRequest/removeReviewer", h.RemoveReviewer).Methods("POST")
+	r.HandleFunc("/pullRequest/ready", h.ReadyPR).Methods("POST")
+	r.HandleFunc("/pullRequest/close", h.ClosePR).Methods("POST")
+	r.HandleFunc("/pullRequest/reopen", h.ReopenPR).Methods("POST")
+	r.HandleFunc("/pullRequest/review", h.Review).Methods("POST")
+	r.HandleFunc("/pullRequest/decisions", h.GetDecisions).Methods("GET")
+	r.HandleFunc("/pullRequest/explain", h.ExplainPR).Methods("GET")
 	r.HandleFunc("/users/getReview", h.GetReviews).Methods("GET")
 	r.HandleFunc("/team/addUser", h.AddUserToTeam).Methods("POST")
 	r.HandleFunc("/team/removeUser", h.RemoveUserFromTeam).Methods("POST")
 
 	r.HandleFunc("/health", h.Health).Methods("GET")
+	r.HandleFunc("/ready", h.Ready).Methods("GET")
 }
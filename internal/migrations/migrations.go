@@ -0,0 +1,306 @@
+// Package migrations holds the versioned database schema and applies it.
+//
+// Every dialect has its own directory with files named
+// NNNN_name.up.sql and NNNN_name.down.sql. Applied versions are recorded
+// in the schema_migrations table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// lockID is the Postgres advisory lock key held while migrating.
+const lockID = 20251101
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// Load returns the migrations of a dialect ordered by version.
+func Load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("unknown dialect %q", dialect)
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		num, title, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("bad migration file name %s", name)
+		}
+		version, err := strconv.Atoi(num)
+		if err != nil {
+			return nil, fmt.Errorf("bad migration file name %s", name)
+		}
+		body, err := files.ReadFile(path.Join(dialect, name))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if m.Name != title {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, title)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+	res := []Migration{}
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up step", m.Version)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+	return res, nil
+}
+
+// Runner applies and rolls back migrations of one dialect.
+type Runner struct {
+	DB         *sql.DB
+	Dialect    string
+	Migrations []Migration
+}
+
+func NewRunner(db *sql.DB, dialect string) (*Runner, error) {
+	ms, err := Load(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{DB: db, Dialect: dialect, Migrations: ms}, nil
+}
+
+// Up applies all pending migrations and returns the versions it applied.
+func (r *Runner) Up(ctx context.Context) ([]int, error) {
+	applied := []int{}
+	err := r.locked(ctx, func(conn *sql.Conn) error {
+		for _, m := range r.Migrations {
+			ok, err := r.step(ctx, conn, m, true)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s up: %w", m.Version, m.Name, err)
+			}
+			if ok {
+				applied = append(applied, m.Version)
+			}
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last n applied migrations and returns their versions.
+func (r *Runner) Down(ctx context.Context, n int) ([]int, error) {
+	reverted := []int{}
+	err := r.locked(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(r.Migrations) - 1; i >= 0 && len(reverted) < n; i-- {
+			m := r.Migrations[i]
+			if _, ok := versions[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %04d_%s has no down step", m.Version, m.Name)
+			}
+			ok, err := r.step(ctx, conn, m, false)
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s down: %w", m.Version, m.Name, err)
+			}
+			if ok {
+				reverted = append(reverted, m.Version)
+			}
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration and whether it has been applied.
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	conn, err := r.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	versions, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	res := []Status{}
+	for _, m := range r.Migrations {
+		st := Status{Version: m.Version, Name: m.Name}
+		if at, ok := versions[m.Version]; ok {
+			st.Applied = true
+			st.AppliedAt = &at
+		}
+		res = append(res, st)
+	}
+	return res, nil
+}
+
+// locked runs fn on a single connection while holding the migration lock,
+// so replicas starting at the same time apply each step once. SQLite
+// needs no extra lock: its transactions already take the write lock.
+//
+// On SQLite foreign keys are switched off for the connection, as SQLite
+// requires for migrations that rebuild a table; step checks them before
+// committing instead.
+func (r *Runner) locked(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := r.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	switch r.Dialect {
+	case Postgres:
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+	case SQLite:
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys=OFF"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys=ON")
+	}
+	if err := ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// step runs one direction of a migration in its own transaction. It
+// re-checks schema_migrations inside the transaction and reports false
+// when there was nothing to do.
+func (r *Runner) step(ctx context.Context, conn *sql.Conn, m Migration, up bool) (bool, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var applied bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version=$1)", m.Version).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
+	if applied == up {
+		return false, nil
+	}
+	if up {
+		if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+			return false, err
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations(version, name, applied_at) VALUES($1,$2,$3)",
+			m.Version, m.Name, time.Now().UTC())
+	} else {
+		if _, err := tx.ExecContext(ctx, m.Down); err != nil {
+			return false, err
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version=$1", m.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+	if r.Dialect == SQLite {
+		if err := checkForeignKeys(ctx, tx); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+func checkForeignKeys(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var table string
+		var rowid sql.NullInt64
+		var parent string
+		var fkid int
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return err
+		}
+		return fmt.Errorf("foreign key violation in %s referencing %s", table, parent)
+	}
+	return rows.Err()
+}
+
+func ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version BIGINT PRIMARY KEY,
+  name TEXT NOT NULL,
+  applied_at TIMESTAMP NOT NULL
+)`)
+	return err
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := map[int]time.Time{}
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		res[v] = at
+	}
+	return res, rows.Err()
+}
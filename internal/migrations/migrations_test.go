@@ -0,0 +1,149 @@
+package migrations_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/migrations"
+	"github.com/ilya2044/avito2025/internal/model"
+	"github.com/ilya2044/avito2025/internal/storage"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.sqlite")
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// schema returns the DDL of every table and index but schema_migrations
+// and SQLite's own tables.
+func schema(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT type || ' ' || name || ': ' || sql FROM sqlite_master
+WHERE sql IS NOT NULL AND name <> 'schema_migrations' AND name NOT LIKE 'sqlite_%' ORDER BY type, name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	res := []string{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		res = append(res, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func versions(ms []migrations.Migration) []int {
+	res := []int{}
+	for _, m := range ms {
+		res = append(res, m.Version)
+	}
+	return res
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSQLiteUpDownUp(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	r, err := migrations.NewRunner(db, migrations.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := versions(r.Migrations)
+	if len(all) != 17 {
+		t.Fatalf("got %d migrations, want 17", len(all))
+	}
+
+	applied, err := r.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(applied, all) {
+		t.Fatalf("up applied %v, want %v", applied, all)
+	}
+	want := schema(t, db)
+
+	// Roll back a database with data in it, not just an empty schema.
+	repo := storage.NewSQLiteRepository(db)
+	team := model.Team{TeamName: "backend", Members: []model.TeamMember{
+		{UserID: "u1", Username: "Alice", IsActive: true, Weight: model.DefaultWeight},
+		{UserID: "u2", Username: "Bob", IsActive: true, Weight: model.DefaultWeight},
+	}}
+	if err := repo.CreateTeam(ctx, team); err != nil {
+		t.Fatal(err)
+	}
+	pr := model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "u1", Status: model.StatusOpen}
+	if err := repo.CreatePullRequest(ctx, pr, []storage.Assignment{{UserID: "u2"}}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	reverted, err := r.Down(ctx, 17)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantReverted := []int{}
+	for i := len(all) - 1; i >= 0; i-- {
+		wantReverted = append(wantReverted, all[i])
+	}
+	if !equalInts(reverted, wantReverted) {
+		t.Fatalf("down reverted %v, want %v", reverted, wantReverted)
+	}
+	if left := schema(t, db); len(left) != 0 {
+		t.Fatalf("schema left after down: %v", left)
+	}
+	st, err := r.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range st {
+		if s.Applied {
+			t.Errorf("migration %d still applied", s.Version)
+		}
+	}
+
+	applied, err = r.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalInts(applied, all) {
+		t.Fatalf("second up applied %v, want %v", applied, all)
+	}
+	got := schema(t, db)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("schema after up, down, up differs:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	applied, err = r.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("third up applied %v, want nothing", applied)
+	}
+}
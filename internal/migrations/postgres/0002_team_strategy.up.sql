@@ -0,0 +1 @@
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS assignment_strategy TEXT NOT NULL DEFAULT 'least_loaded';
@@ -0,0 +1,3 @@
+ALTER TABLE teams
+  DROP COLUMN IF EXISTS min_reviewers,
+  DROP COLUMN IF EXISTS max_reviewers;
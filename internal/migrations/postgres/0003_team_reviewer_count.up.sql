@@ -0,0 +1,3 @@
+ALTER TABLE teams
+  ADD COLUMN IF NOT EXISTS min_reviewers INTEGER NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS max_reviewers INTEGER NOT NULL DEFAULT 2;
@@ -0,0 +1,2 @@
+-- rr_cursor is the user_id last picked by the round_robin strategy.
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS rr_cursor TEXT NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE pr_reviewers
+  DROP COLUMN IF EXISTS state,
+  DROP COLUMN IF EXISTS comment,
+  DROP COLUMN IF EXISTS assigned_at,
+  DROP COLUMN IF EXISTS decided_at;
@@ -0,0 +1,6 @@
+ALTER TABLE pr_reviewers
+  ADD COLUMN IF NOT EXISTS state TEXT NOT NULL DEFAULT 'PENDING'
+    CHECK (state IN ('PENDING','APPROVED','CHANGES_REQUESTED','COMMENTED')),
+  ADD COLUMN IF NOT EXISTS comment TEXT NULL,
+  ADD COLUMN IF NOT EXISTS assigned_at TIMESTAMP WITH TIME ZONE NULL,
+  ADD COLUMN IF NOT EXISTS decided_at TIMESTAMP WITH TIME ZONE NULL;
@@ -0,0 +1 @@
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS required_approvals INTEGER NOT NULL DEFAULT 0;
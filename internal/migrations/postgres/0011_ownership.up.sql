@@ -0,0 +1,16 @@
+-- Paths changed by a pull request, used to find reviewers who own them.
+CREATE TABLE IF NOT EXISTS pull_request_files (
+  pr_id TEXT NOT NULL REFERENCES pull_requests(pull_request_id) ON DELETE CASCADE,
+  path TEXT NOT NULL,
+  PRIMARY KEY (pr_id, path)
+);
+
+-- CODEOWNERS-style rules of a team. owners is a space separated list of
+-- user ids; for each path the rule with the highest position wins.
+CREATE TABLE IF NOT EXISTS team_ownership_rules (
+  team_name TEXT NOT NULL REFERENCES teams(team_name) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  pattern TEXT NOT NULL,
+  owners TEXT NOT NULL,
+  PRIMARY KEY (team_name, position)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS pull_requests_author_idx;
+ALTER TABLE teams DROP COLUMN IF EXISTS pairing_history;
@@ -0,0 +1,3 @@
+-- weight scales a user's chance in random draws; tier marks seniority.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS weight DOUBLE PRECISION NOT NULL DEFAULT 1 CHECK (weight > 0);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tier TEXT NULL CHECK (tier IN ('junior','senior'));
@@ -0,0 +1,11 @@
+-- Every reviewer assignment with the seed and selector inputs of its
+-- draws, stored as JSON, so it can be replayed later.
+CREATE TABLE IF NOT EXISTS assignment_decisions (
+  id BIGSERIAL PRIMARY KEY,
+  pr_id TEXT NOT NULL REFERENCES pull_requests(pull_request_id) ON DELETE CASCADE,
+  action TEXT NOT NULL,
+  replaced_user_id TEXT NULL,
+  draws TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX IF NOT EXISTS assignment_decisions_pr_idx ON assignment_decisions(pr_id, id);
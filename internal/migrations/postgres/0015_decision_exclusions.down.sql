@@ -0,0 +1 @@
+ALTER TABLE assignment_decisions DROP COLUMN IF EXISTS excluded;
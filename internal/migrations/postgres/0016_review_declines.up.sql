@@ -0,0 +1,9 @@
+-- Reviewers who declined a pull request; they are not assigned to it
+-- again.
+CREATE TABLE IF NOT EXISTS review_declines (
+  pr_id TEXT NOT NULL REFERENCES pull_requests(pull_request_id) ON DELETE CASCADE,
+  user_id TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  reason TEXT NOT NULL,
+  declined_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  PRIMARY KEY (pr_id, user_id)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE teams ADD COLUMN min_reviewers INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE teams ADD COLUMN max_reviewers INTEGER NOT NULL DEFAULT 2;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS team_fallbacks (
+  team_name TEXT NOT NULL REFERENCES teams(team_name) ON DELETE CASCADE,
+  fallback_team TEXT NOT NULL REFERENCES teams(team_name) ON DELETE CASCADE,
+  priority INTEGER NOT NULL,
+  PRIMARY KEY (team_name, fallback_team)
+);
+
+-- fallback_team is set when the reviewer was drawn from a fallback team.
+ALTER TABLE pr_reviewers ADD COLUMN fallback_team TEXT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE pr_reviewers DROP COLUMN state;
+ALTER TABLE pr_reviewers DROP COLUMN comment;
+ALTER TABLE pr_reviewers DROP COLUMN assigned_at;
+ALTER TABLE pr_reviewers DROP COLUMN decided_at;
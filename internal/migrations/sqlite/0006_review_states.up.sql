@@ -0,0 +1,5 @@
+ALTER TABLE pr_reviewers ADD COLUMN state TEXT NOT NULL DEFAULT 'PENDING'
+  CHECK (state IN ('PENDING','APPROVED','CHANGES_REQUESTED','COMMENTED'));
+ALTER TABLE pr_reviewers ADD COLUMN comment TEXT NULL;
+ALTER TABLE pr_reviewers ADD COLUMN assigned_at TIMESTAMP NULL;
+ALTER TABLE pr_reviewers ADD COLUMN decided_at TIMESTAMP NULL;
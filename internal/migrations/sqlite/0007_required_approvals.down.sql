@@ -0,0 +1 @@
+ALTER TABLE teams DROP COLUMN required_approvals;
@@ -0,0 +1 @@
+ALTER TABLE teams ADD COLUMN required_approvals INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,15 @@
+CREATE TABLE pull_requests_old (
+  pull_request_id TEXT PRIMARY KEY,
+  pull_request_name TEXT NOT NULL,
+  author_id TEXT NOT NULL REFERENCES users(user_id),
+  status TEXT NOT NULL CHECK (status IN ('OPEN','MERGED')) DEFAULT 'OPEN',
+  created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  merged_at TIMESTAMP NULL
+);
+INSERT INTO pull_requests_old(pull_request_id, pull_request_name, author_id, status, created_at, merged_at)
+  SELECT pull_request_id, pull_request_name, author_id,
+         CASE WHEN status IN ('DRAFT','CLOSED') THEN 'OPEN' ELSE status END,
+         created_at, merged_at
+  FROM pull_requests;
+DROP TABLE pull_requests;
+ALTER TABLE pull_requests_old RENAME TO pull_requests;
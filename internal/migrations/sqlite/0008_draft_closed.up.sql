@@ -0,0 +1,14 @@
+-- SQLite cannot change a CHECK constraint, so the table is rebuilt.
+CREATE TABLE pull_requests_new (
+  pull_request_id TEXT PRIMARY KEY,
+  pull_request_name TEXT NOT NULL,
+  author_id TEXT NOT NULL REFERENCES users(user_id),
+  status TEXT NOT NULL CHECK (status IN ('DRAFT','OPEN','MERGED','CLOSED')) DEFAULT 'OPEN',
+  created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+  merged_at TIMESTAMP NULL,
+  closed_at TIMESTAMP NULL
+);
+INSERT INTO pull_requests_new(pull_request_id, pull_request_name, author_id, status, created_at, merged_at)
+  SELECT pull_request_id, pull_request_name, author_id, status, created_at, merged_at FROM pull_requests;
+DROP TABLE pull_requests;
+ALTER TABLE pull_requests_new RENAME TO pull_requests;
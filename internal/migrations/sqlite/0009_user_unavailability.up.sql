@@ -0,0 +1,10 @@
+-- A user gets no new reviews while now is in [starts_at, ends_at).
+CREATE TABLE IF NOT EXISTS user_unavailability (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id TEXT NOT NULL REFERENCES users(user_id) ON DELETE CASCADE,
+  starts_at TIMESTAMP NOT NULL,
+  ends_at TIMESTAMP NOT NULL,
+  reason TEXT NOT NULL DEFAULT '',
+  CHECK (ends_at > starts_at)
+);
+CREATE INDEX IF NOT EXISTS user_unavailability_user_idx ON user_unavailability(user_id, ends_at);
@@ -0,0 +1,3 @@
+-- max_open_reviews caps how many OPEN pull requests a user reviews at
+-- once. NULL means no limit.
+ALTER TABLE users ADD COLUMN max_open_reviews INTEGER NULL CHECK (max_open_reviews >= 0);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS team_ownership_rules;
+DROP TABLE IF EXISTS pull_request_files;
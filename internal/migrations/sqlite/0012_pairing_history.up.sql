@@ -0,0 +1,3 @@
+-- How many of the author's latest pull requests count as recent pairings.
+ALTER TABLE teams ADD COLUMN pairing_history INTEGER NOT NULL DEFAULT 5 CHECK (pairing_history >= 0);
+CREATE INDEX IF NOT EXISTS pull_requests_author_idx ON pull_requests(author_id, created_at);
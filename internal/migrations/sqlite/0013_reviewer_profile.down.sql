@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN tier;
+ALTER TABLE users DROP COLUMN weight;
@@ -0,0 +1,2 @@
+-- Users left out of the candidate pools of a decision and why, as JSON.
+ALTER TABLE assignment_decisions ADD COLUMN excluded TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,2 @@
+-- Reviewers named explicitly in a decision rather than drawn, as JSON.
+ALTER TABLE assignment_decisions ADD COLUMN requested TEXT NOT NULL DEFAULT '[]';
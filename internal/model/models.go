@@ -3,14 +3,76 @@ package model
 import "time"
 
 type TeamMember struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
-	IsActive bool   `json:"is_active"`
+	UserID   string  `json:"user_id"`
+	Username string  `json:"username"`
+	IsActive bool    `json:"is_active"`
+	Weight   float64 `json:"weight,omitempty"`
+	Tier     string  `json:"tier,omitempty"`
 }
 
+// Reviewer tiers. A new pull request gets a senior reviewer whenever the
+// author's team has one eligible.
+const (
+	TierJunior = "junior"
+	TierSenior = "senior"
+)
+
+// DefaultWeight is the assignment weight of users who were given none.
+const DefaultWeight = 1.0
+
 type Team struct {
-	TeamName string       `json:"team_name"`
-	Members  []TeamMember `json:"members"`
+	TeamName string        `json:"team_name"`
+	Members  []TeamMember  `json:"members"`
+	Settings *TeamSettings `json:"settings,omitempty"`
+}
+
+// Reviewer assignment strategies a team can choose from.
+const (
+	StrategyRandom      = "random"
+	StrategyLeastLoaded = "least_loaded"
+	StrategyRoundRobin  = "round_robin"
+	StrategyWeighted    = "weighted"
+)
+
+type TeamSettings struct {
+	AssignmentStrategy string `json:"assignment_strategy"`
+	MinReviewers       int    `json:"min_reviewers"`
+	MaxReviewers       int    `json:"max_reviewers"`
+	// RequiredApprovals is how many assigned reviewers must approve
+	// before a pull request of the team can be merged.
+	RequiredApprovals int `json:"required_approvals"`
+	// FallbackTeams are asked for reviewers, in order, when the team
+	// itself has nobody eligible left.
+	FallbackTeams []string `json:"fallback_teams"`
+	// PairingHistory is how many of the author's latest pull requests
+	// are looked at to spot reviewers the author keeps getting. Such
+	// reviewers are down-weighted; 0 turns this off.
+	PairingHistory int `json:"pairing_history"`
+	// OwnershipRules map file paths to the members who know them best.
+	// Owners of the files a pull request changes are picked first.
+	OwnershipRules []OwnershipRule `json:"ownership_rules"`
+}
+
+// OwnershipRule is a CODEOWNERS-style line: the owners of the paths
+// matching Pattern. For every file the last matching rule applies.
+type OwnershipRule struct {
+	Pattern string   `json:"pattern"`
+	Owners  []string `json:"owners"`
+}
+
+// TeamSettingsUpdate lists the settings to change; nil fields are kept.
+type TeamSettingsUpdate struct {
+	AssignmentStrategy *string          `json:"assignment_strategy"`
+	MinReviewers       *int             `json:"min_reviewers"`
+	MaxReviewers       *int             `json:"max_reviewers"`
+	FallbackTeams      *[]string        `json:"fallback_teams"`
+	RequiredApprovals  *int             `json:"required_approvals"`
+	PairingHistory     *int             `json:"pairing_history"`
+	OwnershipRules     *[]OwnershipRule `json:"ownership_rules"`
+}
+
+func DefaultTeamSettings() TeamSettings {
+	return TeamSettings{AssignmentStrategy: StrategyLeastLoaded, MinReviewers: 0, MaxReviewers: 2, PairingHistory: 5, FallbackTeams: []string{}, OwnershipRules: []OwnershipRule{}}
 }
 
 type User struct {
@@ -18,16 +80,173 @@ type User struct {
 	Username string `json:"username"`
 	TeamName string `json:"team_name"`
 	IsActive bool   `json:"is_active"`
+	// MaxOpenReviews caps how many OPEN pull requests the user reviews at
+	// once; users at the cap are skipped when reviewers are picked. Nil
+	// means no limit.
+	MaxOpenReviews *int `json:"max_open_reviews,omitempty"`
+	// Weight scales the user's chance in random draws.
+	Weight float64 `json:"weight,omitempty"`
+	// Tier is TierJunior, TierSenior or empty.
+	Tier string `json:"tier,omitempty"`
+}
+
+// UserCapacity is a user's review limit next to their current load.
+type UserCapacity struct {
+	UserID         string `json:"user_id"`
+	MaxOpenReviews *int   `json:"max_open_reviews"`
+	OpenReviews    int    `json:"open_reviews"`
+}
+
+// Unavailability is a period, such as a vacation, during which the user
+// is not picked as a reviewer. EndsAt is exclusive.
+type Unavailability struct {
+	ID       int64     `json:"id"`
+	UserID   string    `json:"user_id"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Reason   string    `json:"reason,omitempty"`
 }
 
 type PullRequest struct {
-	PullRequestID     string     `json:"pull_request_id"`
-	PullRequestName   string     `json:"pull_request_name"`
-	AuthorID          string     `json:"author_id"`
-	Status            string     `json:"status"`
-	AssignedReviewers []string   `json:"assigned_reviewers"`
-	CreatedAt         *time.Time `json:"createdAt,omitempty"`
-	MergedAt          *time.Time `json:"mergedAt,omitempty"`
+	PullRequestID     string   `json:"pull_request_id"`
+	PullRequestName   string   `json:"pull_request_name"`
+	AuthorID          string   `json:"author_id"`
+	Status            string   `json:"status"`
+	AssignedReviewers []string `json:"assigned_reviewers"`
+	// Files are the paths the pull request changes.
+	Files []string `json:"files,omitempty"`
+	// FallbackReviewers lists the assigned reviewers that came from a
+	// fallback team.
+	FallbackReviewers []FallbackReviewer `json:"fallback_reviewers,omitempty"`
+	// Reviews holds each assigned reviewer's decision.
+	Reviews []Review `json:"reviews"`
+	// Declines lists the reviewers who declined the pull request. They
+	// are not assigned to it again.
+	Declines  []Decline  `json:"declines,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	MergedAt  *time.Time `json:"mergedAt,omitempty"`
+	ClosedAt  *time.Time `json:"closedAt,omitempty"`
+}
+
+// Pull request statuses. Reviewers are assigned when a pull request
+// becomes OPEN; a DRAFT has none yet.
+const (
+	StatusDraft  = "DRAFT"
+	StatusOpen   = "OPEN"
+	StatusMerged = "MERGED"
+	StatusClosed = "CLOSED"
+)
+
+// Review states of an assigned reviewer.
+const (
+	ReviewPending          = "PENDING"
+	ReviewApproved         = "APPROVED"
+	ReviewChangesRequested = "CHANGES_REQUESTED"
+	ReviewCommented        = "COMMENTED"
+)
+
+type Review struct {
+	UserID     string     `json:"user_id"`
+	State      string     `json:"state"`
+	Comment    string     `json:"comment,omitempty"`
+	AssignedAt *time.Time `json:"assigned_at,omitempty"`
+	DecidedAt  *time.Time `json:"decided_at,omitempty"`
+}
+
+// Decline is a reviewer turning down a pull request they were assigned.
+type Decline struct {
+	UserID     string     `json:"user_id"`
+	Reason     string     `json:"reason"`
+	DeclinedAt *time.Time `json:"declined_at,omitempty"`
+}
+
+// Reassignment reports what happened to one open review of a
+// deactivated user. Reason is set when nobody could take it over.
+type Reassignment struct {
+	PullRequestID string `json:"pull_request_id"`
+	OldUserID     string `json:"old_user_id"`
+	ReplacedBy    string `json:"replaced_by,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+// Actions that assign reviewers, as recorded in a Decision.
+const (
+	ActionCreate     = "create"
+	ActionReady      = "ready"
+	ActionReopen     = "reopen"
+	ActionReassign   = "reassign"
+	ActionDeactivate = "deactivate"
+	ActionDecline    = "decline"
+	ActionAdd        = "add"
+)
+
+// Decision records how reviewers were picked for a pull request: one
+// Draw per candidate pool the selectors were run on.
+type Decision struct {
+	ID            int64  `json:"id"`
+	PullRequestID string `json:"pull_request_id"`
+	Action        string `json:"action"`
+	// ReplacedUserID is the reviewer replaced by a reassignment, a
+	// deactivation or a reopening, or who declined.
+	ReplacedUserID string `json:"replaced_user_id,omitempty"`
+	// Requested lists the reviewers named explicitly rather than drawn.
+	Requested []string `json:"requested,omitempty"`
+	Draws     []Draw   `json:"draws"`
+	// Excluded lists the members of the teams looked at who were not
+	// candidates.
+	Excluded  []Exclusion `json:"excluded"`
+	CreatedAt *time.Time  `json:"created_at,omitempty"`
+}
+
+// Reasons a team member is not a candidate.
+const (
+	ExcludedAuthor      = "author"
+	ExcludedInactive    = "inactive"
+	ExcludedUnavailable = "unavailable"
+	ExcludedAtCapacity  = "at_capacity"
+	ExcludedAssigned    = "already_assigned"
+	ExcludedReplaced    = "replaced"
+	ExcludedDeactivated = "deactivated"
+	ExcludedDeclined    = "declined"
+)
+
+type Exclusion struct {
+	UserID string `json:"user_id"`
+	Team   string `json:"team"`
+	Reason string `json:"reason"`
+}
+
+// Draw is one selector run with everything needed to replay it: the
+// selector fed the candidates in this order, with this seed, returns
+// Picked.
+type Draw struct {
+	Team     string `json:"team"`
+	Strategy string `json:"strategy"`
+	Fallback bool   `json:"fallback,omitempty"`
+	Owners   bool   `json:"owners,omitempty"`
+	Senior   bool   `json:"senior,omitempty"`
+	Seed     int64  `json:"seed"`
+	N        int    `json:"n"`
+	Cursor   string `json:"cursor,omitempty"`
+	// Candidates are the inputs the selector saw.
+	Candidates []DrawCandidate `json:"candidates"`
+	Picked     []string        `json:"picked"`
+	// Reproduced tells whether replaying the draw gave Picked again. It
+	// is filled in when decisions are read back.
+	Reproduced *bool `json:"reproduced,omitempty"`
+}
+
+type DrawCandidate struct {
+	UserID        string  `json:"user_id"`
+	OpenReviews   int     `json:"open_reviews"`
+	RecentReviews int     `json:"recent_reviews"`
+	Weight        float64 `json:"weight"`
+	Tier          string  `json:"tier,omitempty"`
+}
+
+type FallbackReviewer struct {
+	UserID   string `json:"user_id"`
+	TeamName string `json:"team_name"`
 }
 
 type PullRequestShort struct {
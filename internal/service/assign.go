@@ -0,0 +1,448 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/ilya2044/avito2025/internal/model"
+	"github.com/ilya2044/avito2025/internal/storage"
+)
+
+// candidatePool is the eligible reviewers of one team. Pools are drawn
+// from in order: the primary team first, then its fallback teams. Each
+// team comes as two pools, the owners of the changed files before
+// everyone else.
+type candidatePool struct {
+	team     string
+	author   string
+	fallback bool
+	owners   bool
+	senior   bool
+	cands    []model.User
+}
+
+// candidatePools returns the active members of teamName and of its
+// fallback teams in priority order, without the author and the excluded
+// users, which map to the reason they are excluded. Members owning any
+// of files under their team's ownership rules come first. Everyone left
+// out is recorded in the plan with the reason.
+func (s *Service) candidatePools(ctx context.Context, p *assignPlan, teamName, author string, files []string, exclude map[string]string) ([]candidatePool, error) {
+	ts, err := p.teamSettings(ctx, teamName)
+	if err != nil {
+		return nil, err
+	}
+	pools := []candidatePool{}
+	for i, team := range append([]string{teamName}, ts.FallbackTeams...) {
+		members, err := p.activeMembers(ctx, team)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.loadOpenReviews(ctx, members); err != nil {
+			return nil, err
+		}
+		teamSettings, err := p.teamSettings(ctx, team)
+		if err != nil {
+			return nil, err
+		}
+		all, err := p.teamMembers(ctx, team)
+		if err != nil {
+			return nil, err
+		}
+		active := map[string]model.User{}
+		for _, u := range members {
+			active[u.UserID] = u
+		}
+		owned := fileOwners(teamSettings.OwnershipRules, files)
+		owners, others := []model.User{}, []model.User{}
+		for _, m := range all {
+			u, ok := active[m.UserID]
+			reason := ""
+			switch {
+			case m.UserID == author:
+				reason = model.ExcludedAuthor
+			case exclude[m.UserID] != "":
+				reason = exclude[m.UserID]
+			case !m.IsActive:
+				reason = model.ExcludedInactive
+			case !ok:
+				reason = model.ExcludedUnavailable
+			case p.atCapacity(u):
+				reason = model.ExcludedAtCapacity
+			case owned[u.UserID]:
+				owners = append(owners, u)
+			default:
+				others = append(others, u)
+			}
+			if reason != "" {
+				p.excluded = append(p.excluded, model.Exclusion{UserID: m.UserID, Team: team, Reason: reason})
+			}
+		}
+		pools = append(pools,
+			candidatePool{team: team, author: author, fallback: i > 0, owners: true, cands: owners},
+			candidatePool{team: team, author: author, fallback: i > 0, cands: others})
+	}
+	return pools, nil
+}
+
+func countCandidates(pools []candidatePool) int {
+	n := 0
+	for _, p := range pools {
+		n += len(p.cands)
+	}
+	return n
+}
+
+// drawReviewers picks n reviewers, exhausting each pool before moving to
+// the next one. Every pool is drawn from with its own team's strategy.
+func (s *Service) drawReviewers(ctx context.Context, p *assignPlan, pools []candidatePool, n int) ([]storage.Assignment, error) {
+	assigned := []storage.Assignment{}
+	for _, pool := range pools {
+		need := n - len(assigned)
+		if need <= 0 {
+			break
+		}
+		if len(pool.cands) == 0 {
+			continue
+		}
+		picked, err := s.selectReviewers(ctx, p, pool, need)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range picked {
+			a := storage.Assignment{UserID: u.UserID}
+			if pool.fallback {
+				a.FallbackTeam = pool.team
+			}
+			assigned = append(assigned, a)
+		}
+	}
+	return assigned, nil
+}
+
+// drawWithSenior draws n reviewers for a new pull request like
+// drawReviewers, but first draws one senior when the author's own team
+// has one eligible.
+func (s *Service) drawWithSenior(ctx context.Context, p *assignPlan, pools []candidatePool, n int) ([]storage.Assignment, error) {
+	seniors := []candidatePool{}
+	for _, pool := range pools {
+		if pool.fallback {
+			continue
+		}
+		sp := pool
+		sp.senior = true
+		sp.cands = []model.User{}
+		for _, u := range pool.cands {
+			if u.Tier == model.TierSenior {
+				sp.cands = append(sp.cands, u)
+			}
+		}
+		seniors = append(seniors, sp)
+	}
+	if n == 0 || countCandidates(seniors) == 0 {
+		return s.drawReviewers(ctx, p, pools, n)
+	}
+	assigned, err := s.drawReviewers(ctx, p, seniors, 1)
+	if err != nil {
+		return nil, err
+	}
+	rest := make([]candidatePool, len(pools))
+	for i, pool := range pools {
+		rest[i] = pool
+		rest[i].cands = []model.User{}
+		for _, u := range pool.cands {
+			if u.UserID != assigned[0].UserID {
+				rest[i].cands = append(rest[i].cands, u)
+			}
+		}
+	}
+	more, err := s.drawReviewers(ctx, p, rest, n-1)
+	if err != nil {
+		return nil, err
+	}
+	return append(assigned, more...), nil
+}
+
+// reviewersCount decides how many reviewers a new pull request gets out
+// of the available candidates.
+func reviewersCount(ts model.TeamSettings, requested *int, available int) (int, error) {
+	if requested != nil {
+		n := *requested
+		if n < ts.MinReviewers || n > ts.MaxReviewers {
+			return 0, fmt.Errorf("%w: %d is outside %d..%d", ErrBadCount, n, ts.MinReviewers, ts.MaxReviewers)
+		}
+		if n > available {
+			return 0, fmt.Errorf("%w: requested %d, available %d", ErrNotEnough, n, available)
+		}
+		return n, nil
+	}
+	if available < ts.MinReviewers {
+		return 0, fmt.Errorf("%w: team requires %d, available %d", ErrNotEnough, ts.MinReviewers, available)
+	}
+	if available < ts.MaxReviewers {
+		return available, nil
+	}
+	return ts.MaxReviewers, nil
+}
+
+// assignPlan carries open review counts and rotation cursors across the
+// draws of one write, so later draws see the reviewers picked earlier,
+// and records the draws for the write's decisions.
+// It also caches what it reads, so planning many draws does not query
+// the store for every one of them.
+type assignPlan struct {
+	repo     storage.Store
+	settings map[string]model.TeamSettings
+	members  map[string][]model.User
+	users    map[string]model.User
+	load     map[string]int
+	loaded   map[string]bool
+	recent   map[string]map[string]int
+	draws    []model.Draw
+	excluded []model.Exclusion
+	teams    map[string][]model.TeamMember
+	from     map[string]string
+	cursors  map[string]string
+}
+
+func (s *Service) newPlan() *assignPlan {
+	return &assignPlan{
+		repo:     s.Repo,
+		settings: map[string]model.TeamSettings{},
+		members:  map[string][]model.User{},
+		users:    map[string]model.User{},
+		load:     map[string]int{},
+		loaded:   map[string]bool{},
+		recent:   map[string]map[string]int{},
+		teams:    map[string][]model.TeamMember{},
+		from:     map[string]string{},
+		cursors:  map[string]string{},
+	}
+}
+
+func (p *assignPlan) teamSettings(ctx context.Context, team string) (model.TeamSettings, error) {
+	if ts, ok := p.settings[team]; ok {
+		return ts, nil
+	}
+	ts, err := p.repo.GetTeamSettings(ctx, team)
+	if err != nil {
+		return ts, err
+	}
+	p.settings[team] = ts
+	return ts, nil
+}
+
+func (p *assignPlan) activeMembers(ctx context.Context, team string) ([]model.User, error) {
+	if ms, ok := p.members[team]; ok {
+		return ms, nil
+	}
+	ms, err := p.repo.GetActiveTeamMembers(ctx, team, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.members[team] = ms
+	return ms, nil
+}
+
+// teamMembers returns all members of the team, inactive ones included.
+func (p *assignPlan) teamMembers(ctx context.Context, team string) ([]model.TeamMember, error) {
+	if ms, ok := p.teams[team]; ok {
+		return ms, nil
+	}
+	t, err := p.repo.GetTeam(ctx, team)
+	if err != nil {
+		return nil, err
+	}
+	p.teams[team] = t.Members
+	return t.Members, nil
+}
+
+func (p *assignPlan) user(ctx context.Context, userID string) (model.User, error) {
+	if u, ok := p.users[userID]; ok {
+		return u, nil
+	}
+	u, err := p.repo.GetUser(ctx, userID)
+	if err != nil {
+		return u, err
+	}
+	p.users[userID] = u
+	return u, nil
+}
+
+// loadOpenReviews counts the OPEN reviews of the users not counted yet.
+func (p *assignPlan) loadOpenReviews(ctx context.Context, users []model.User) error {
+	ids := []string{}
+	for _, u := range users {
+		if !p.loaded[u.UserID] {
+			ids = append(ids, u.UserID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	load, err := p.repo.CountOpenReviews(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		p.load[id] = load[id]
+		p.loaded[id] = true
+	}
+	return nil
+}
+
+// recentReviews counts who reviewed the author's latest pull requests,
+// looking as far back as the author's team pairing_history.
+func (p *assignPlan) recentReviews(ctx context.Context, authorID string) (map[string]int, error) {
+	if err := p.loadRecentReviews(ctx, []string{authorID}); err != nil {
+		return nil, err
+	}
+	return p.recent[authorID], nil
+}
+
+// loadRecentReviews counts the recent reviewers of the authors not
+// counted yet with one query. Their users should be loaded already, or
+// each is read on its own.
+func (p *assignPlan) loadRecentReviews(ctx context.Context, authorIDs []string) error {
+	limits := map[string]int{}
+	for _, id := range authorIDs {
+		if _, ok := p.recent[id]; ok {
+			continue
+		}
+		author, err := p.user(ctx, id)
+		if err != nil {
+			return err
+		}
+		ts, err := p.teamSettings(ctx, author.TeamName)
+		if err != nil {
+			return err
+		}
+		limits[id] = ts.PairingHistory
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+	recent, err := p.repo.CountRecentReviews(ctx, limits)
+	if err != nil {
+		return err
+	}
+	for id := range limits {
+		p.recent[id] = recent[id]
+	}
+	return nil
+}
+
+// atCapacity reports whether u already has max_open_reviews reviews,
+// counting the ones planned so far.
+func (p *assignPlan) atCapacity(u model.User) bool {
+	return u.MaxOpenReviews != nil && p.load[u.UserID] >= *u.MaxOpenReviews
+}
+
+// loadUsers fills the user cache with one query.
+func (p *assignPlan) loadUsers(ctx context.Context, userIDs []string) error {
+	users, err := p.repo.GetUsers(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		p.users[u.UserID] = u
+	}
+	return nil
+}
+
+// rotations returns the cursor moves of the plan to store with it.
+func (p *assignPlan) rotations() []storage.Rotation {
+	rots := []storage.Rotation{}
+	for team, to := range p.cursors {
+		if to != p.from[team] {
+			rots = append(rots, storage.Rotation{Team: team, From: p.from[team], To: to})
+		}
+	}
+	sort.Slice(rots, func(i, j int) bool { return rots[i].Team < rots[j].Team })
+	return rots
+}
+
+// selectReviewers picks up to n of the pool's candidates with the
+// strategy configured for its team and records the picks in the plan.
+func (s *Service) selectReviewers(ctx context.Context, p *assignPlan, pool candidatePool, n int) ([]model.User, error) {
+	teamName, cands := pool.team, pool.cands
+	ts, err := p.teamSettings(ctx, teamName)
+	if err != nil {
+		return nil, err
+	}
+	sel, ok := s.Selectors[ts.AssignmentStrategy]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown assignment_strategy %q", ErrBadSettings, ts.AssignmentStrategy)
+	}
+	if err := p.loadOpenReviews(ctx, cands); err != nil {
+		return nil, err
+	}
+	recent, err := p.recentReviews(ctx, pool.author)
+	if err != nil {
+		return nil, err
+	}
+	seed := s.Seeds.NextSeed()
+	in := Selection{Team: teamName, N: n, Rand: rand.New(rand.NewSource(seed))}
+	draw := model.Draw{
+		Team:       teamName,
+		Strategy:   ts.AssignmentStrategy,
+		Fallback:   pool.fallback,
+		Owners:     pool.owners,
+		Senior:     pool.senior,
+		Seed:       seed,
+		N:          n,
+		Candidates: []model.DrawCandidate{},
+		Picked:     []string{},
+	}
+	for _, c := range cands {
+		cand := Candidate{User: c, OpenReviews: p.load[c.UserID], RecentReviews: recent[c.UserID]}
+		in.Candidates = append(in.Candidates, cand)
+		draw.Candidates = append(draw.Candidates, model.DrawCandidate{
+			UserID:        c.UserID,
+			OpenReviews:   cand.OpenReviews,
+			RecentReviews: cand.RecentReviews,
+			Weight:        userWeight(cand),
+			Tier:          c.Tier,
+		})
+	}
+	rs, rotating := sel.(RotatingSelector)
+	if rotating {
+		cursor, ok := p.cursors[teamName]
+		if !ok {
+			cursor, err = s.Repo.GetRotationCursor(ctx, teamName)
+			if err != nil {
+				return nil, err
+			}
+			p.from[teamName] = cursor
+		}
+		in.Cursor = cursor
+		draw.Cursor = cursor
+	}
+	picked := sel.Select(in)
+	for _, u := range picked {
+		p.load[u.UserID]++
+		draw.Picked = append(draw.Picked, u.UserID)
+	}
+	p.draws = append(p.draws, draw)
+	if rotating && len(picked) > 0 {
+		p.cursors[teamName] = rs.NextCursor(picked)
+	}
+	return picked, nil
+}
+
+// rotationAttempts bounds how often an assignment is recomputed when
+// another request moved the team's rotation cursor first.
+const rotationAttempts = 5
+
+func (s *Service) retryRotation(fn func() error) error {
+	var err error
+	for i := 0; i < rotationAttempts; i++ {
+		err = fn()
+		if !errors.Is(err, storage.ErrRotationConflict) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestReviewersCount(t *testing.T) {
+	ts := model.TeamSettings{MinReviewers: 1, MaxReviewers: 3}
+	tests := []struct {
+		name      string
+		requested *int
+		available int
+		want      int
+		err       error
+	}{
+		{"max when enough", nil, 5, 3, nil},
+		{"all available below max", nil, 2, 2, nil},
+		{"exactly min", nil, 1, 1, nil},
+		{"below min", nil, 0, 0, ErrNotEnough},
+		{"requested", intPtr(2), 5, 2, nil},
+		{"requested min", intPtr(1), 1, 1, nil},
+		{"requested below min", intPtr(0), 5, 0, ErrBadCount},
+		{"requested above max", intPtr(4), 5, 0, ErrBadCount},
+		{"requested above available", intPtr(3), 2, 0, ErrNotEnough},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reviewersCount(ts, tt.requested, tt.available)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateWithReviewersCount(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	members := []model.TeamMember{member("a", true), member("u1", true), member("u2", true), member("u3", true), member("u4", false)}
+	createTeam(t, s, "backend", members, model.TeamSettingsUpdate{MinReviewers: intPtr(1), MaxReviewers: intPtr(3)})
+
+	ts, err := s.Repo.GetTeamSettings(ctx, "backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := model.DefaultTeamSettings()
+	if ts.MinReviewers != 1 || ts.MaxReviewers != 3 || ts.AssignmentStrategy != def.AssignmentStrategy || ts.PairingHistory != def.PairingHistory {
+		t.Errorf("settings = %+v, want min 1, max 3 and the other defaults", ts)
+	}
+
+	tests := []struct {
+		requested *int
+		want      int
+		err       error
+	}{
+		{nil, 3, nil},
+		{intPtr(1), 1, nil},
+		{intPtr(2), 2, nil},
+		{intPtr(0), 0, ErrBadCount},
+		{intPtr(4), 0, ErrBadCount},
+	}
+	for i, tt := range tests {
+		pr := model.PullRequest{PullRequestID: fmt.Sprintf("pr-%d", i), PullRequestName: "x", AuthorID: "a"}
+		got, err := s.CreatePullRequest(ctx, pr, CreateOptions{ReviewersCount: tt.requested})
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("case %d: err = %v, want %v", i, err, tt.err)
+		}
+		if err == nil && len(got.AssignedReviewers) != tt.want {
+			t.Errorf("case %d: got %d reviewers, want %d", i, len(got.AssignedReviewers), tt.want)
+		}
+	}
+
+	if _, err := s.UpdateTeamSettings(ctx, "backend", model.TeamSettingsUpdate{MinReviewers: intPtr(4)}); !errors.Is(err, ErrBadSettings) {
+		t.Errorf("min above max: err = %v, want ErrBadSettings", err)
+	}
+	if _, err := s.UpdateTeamSettings(ctx, "backend", model.TeamSettingsUpdate{MinReviewers: intPtr(3)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetUserIsActive(ctx, "u3", false); err != nil {
+		t.Fatal(err)
+	}
+	pr := model.PullRequest{PullRequestID: "pr-z", PullRequestName: "x", AuthorID: "a"}
+	if _, err := s.CreatePullRequest(ctx, pr, CreateOptions{}); !errors.Is(err, ErrNotEnough) {
+		t.Errorf("two active for min 3: err = %v, want ErrNotEnough", err)
+	}
+}
+
+func poolIDs(pool candidatePool) []string {
+	ids := []string{}
+	for _, u := range pool.cands {
+		ids = append(ids, u.UserID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// excludedReasons maps the users the plan left out to the reason.
+func excludedReasons(p *assignPlan) map[string]string {
+	res := map[string]string{}
+	for _, e := range p.excluded {
+		res[e.UserID] = e.Reason
+	}
+	return res
+}
+
+type wantPool struct {
+	team     string
+	fallback bool
+	owners   bool
+	ids      []string
+}
+
+func checkPools(t *testing.T, pools []candidatePool, author string, want []wantPool) {
+	t.Helper()
+	if len(pools) != len(want) {
+		t.Fatalf("got %d pools, want %d", len(pools), len(want))
+	}
+	for i, w := range want {
+		got := pools[i]
+		if got.team != w.team || got.fallback != w.fallback || got.owners != w.owners || got.author != author {
+			t.Errorf("pool %d = {%s fallback=%v owners=%v author=%s}, want {%s fallback=%v owners=%v author=%s}",
+				i, got.team, got.fallback, got.owners, got.author, w.team, w.fallback, w.owners, author)
+		}
+		if ids := poolIDs(got); !equalStrings(ids, w.ids) {
+			t.Errorf("pool %d candidates = %v, want %v", i, ids, w.ids)
+		}
+	}
+}
+
+func checkExcluded(t *testing.T, p *assignPlan, want map[string]string) {
+	t.Helper()
+	got := excludedReasons(p)
+	if len(got) != len(want) {
+		t.Errorf("excluded = %v, want %v", got, want)
+	}
+	for id, reason := range want {
+		if got[id] != reason {
+			t.Errorf("excluded[%s] = %q, want %q", id, got[id], reason)
+		}
+	}
+}
+
+func TestCandidatePoolsFallback(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "infra", []model.TeamMember{member("i1", true), member("i2", false)}, model.TeamSettingsUpdate{})
+	createTeam(t, s, "platform", []model.TeamMember{member("p1", true)}, model.TeamSettingsUpdate{})
+	createTeam(t, s, "backend", []model.TeamMember{member("u1", true), member("u2", true), member("u3", false), member("u4", true)},
+		model.TeamSettingsUpdate{FallbackTeams: &[]string{"platform", "infra"}})
+
+	p := s.newPlan()
+	pools, err := s.candidatePools(ctx, p, "backend", "u1", nil, map[string]string{"u4": model.ExcludedReplaced})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPools(t, pools, "u1", []wantPool{
+		{"backend", false, true, []string{}},
+		{"backend", false, false, []string{"u2"}},
+		{"platform", true, true, []string{}},
+		{"platform", true, false, []string{"p1"}},
+		{"infra", true, true, []string{}},
+		{"infra", true, false, []string{"i1"}},
+	})
+	checkExcluded(t, p, map[string]string{
+		"u1": model.ExcludedAuthor,
+		"u3": model.ExcludedInactive,
+		"u4": model.ExcludedReplaced,
+		"i2": model.ExcludedInactive,
+	})
+}
+
+func TestCreateThroughFallback(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "infra", []model.TeamMember{member("i1", true), member("i2", true)}, model.TeamSettingsUpdate{})
+	createTeam(t, s, "platform", []model.TeamMember{member("p1", true)}, model.TeamSettingsUpdate{})
+	createTeam(t, s, "backend", []model.TeamMember{member("a", true), member("u1", true)},
+		model.TeamSettingsUpdate{FallbackTeams: &[]string{"platform", "infra"}, MaxReviewers: intPtr(3)})
+
+	pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "a"}, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.AssignedReviewers) != 3 {
+		t.Fatalf("reviewers = %v, want 3", pr.AssignedReviewers)
+	}
+	// The own team is used up first, then the fallback teams in order.
+	if !containsUser(pr.AssignedReviewers, "u1") || !containsUser(pr.AssignedReviewers, "p1") {
+		t.Errorf("reviewers = %v, want u1, p1 and one of infra", pr.AssignedReviewers)
+	}
+	if got := fallbackIDs(pr, "platform"); !equalStrings(got, []string{"p1"}) {
+		t.Errorf("platform fallback = %v, want [p1]", got)
+	}
+	if got := fallbackIDs(pr, "infra"); len(got) != 1 {
+		t.Errorf("infra fallback = %v, want one of i1, i2", got)
+	}
+	if len(pr.FallbackReviewers) != 2 {
+		t.Errorf("fallback = %+v, want p1 and one of infra", pr.FallbackReviewers)
+	}
+
+	self := []string{"backend"}
+	if _, err := s.UpdateTeamSettings(ctx, "backend", model.TeamSettingsUpdate{FallbackTeams: &self}); !errors.Is(err, ErrBadSettings) {
+		t.Errorf("own fallback: err = %v, want ErrBadSettings", err)
+	}
+	missing := []string{"nobody"}
+	if _, err := s.UpdateTeamSettings(ctx, "backend", model.TeamSettingsUpdate{FallbackTeams: &missing}); !errors.Is(err, ErrBadSettings) {
+		t.Errorf("unknown fallback: err = %v, want ErrBadSettings", err)
+	}
+}
+
+func TestCreatePicksSenior(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("a", true), member("u1", true), member("u2", true), member("u3", true), member("u4", true)}, model.TeamSettingsUpdate{})
+	senior := model.TierSenior
+	if _, err := s.SetUserProfile(ctx, "u4", nil, &senior); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: fmt.Sprintf("pr-%d", i), PullRequestName: "x", AuthorID: "a"}, CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !containsUser(pr.AssignedReviewers, "u4") {
+			t.Fatalf("pr-%d reviewers = %v, want the senior u4 among them", i, pr.AssignedReviewers)
+		}
+	}
+
+	weight, bad := -1.0, "lead"
+	if _, err := s.SetUserProfile(ctx, "u1", &weight, nil); !errors.Is(err, ErrBadProfile) {
+		t.Errorf("negative weight: err = %v, want ErrBadProfile", err)
+	}
+	if _, err := s.SetUserProfile(ctx, "u1", nil, &bad); !errors.Is(err, ErrBadProfile) {
+		t.Errorf("unknown tier: err = %v, want ErrBadProfile", err)
+	}
+	weight = 2.5
+	u, err := s.SetUserProfile(ctx, "u1", &weight, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Weight != 2.5 || u.Tier != "" {
+		t.Errorf("profile = weight %v tier %q, want 2.5 and no tier", u.Weight, u.Tier)
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+// AddUnavailability schedules a period during which the user is not
+// picked as a reviewer. The user does not have to be deactivated and
+// comes back on their own when the period ends.
+func (s *Service) AddUnavailability(ctx context.Context, u model.Unavailability) (model.Unavailability, error) {
+	if !u.EndsAt.After(u.StartsAt) {
+		return model.Unavailability{}, fmt.Errorf("%w: ends_at must be after starts_at", ErrBadPeriod)
+	}
+	if !u.EndsAt.After(time.Now()) {
+		return model.Unavailability{}, fmt.Errorf("%w: period has already ended", ErrBadPeriod)
+	}
+	if _, err := s.Repo.GetUser(ctx, u.UserID); err != nil {
+		return model.Unavailability{}, err
+	}
+	return s.Repo.AddUnavailability(ctx, u)
+}
+
+// ListUnavailability returns the user's current and upcoming periods.
+func (s *Service) ListUnavailability(ctx context.Context, userID string) ([]model.Unavailability, error) {
+	if _, err := s.Repo.GetUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.Repo.ListUnavailability(ctx, userID)
+}
+
+func (s *Service) RemoveUnavailability(ctx context.Context, userID string, id int64) error {
+	return s.Repo.RemoveUnavailability(ctx, userID, id)
+}
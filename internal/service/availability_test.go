@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+func TestUnavailableUsersAreSkipped(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("u1", true), member("u2", true), member("u3", true), member("u4", true)}, model.TeamSettingsUpdate{})
+	now := time.Now()
+	if _, err := s.AddUnavailability(ctx, model.Unavailability{UserID: "u2", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	// A period that has not started yet does not count.
+	if _, err := s.AddUnavailability(ctx, model.Unavailability{UserID: "u3", StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := s.newPlan()
+	pools, err := s.candidatePools(ctx, p, "backend", "u1", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPools(t, pools, "u1", []wantPool{
+		{"backend", false, true, []string{}},
+		{"backend", false, false, []string{"u3", "u4"}},
+	})
+	checkExcluded(t, p, map[string]string{"u1": model.ExcludedAuthor, "u2": model.ExcludedUnavailable})
+
+	pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "u1"}, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(sortedReviewers(pr), []string{"u3", "u4"}) {
+		t.Errorf("reviewers = %v, want [u3 u4]", pr.AssignedReviewers)
+	}
+}
+
+func TestAddUnavailability(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("u1", true)}, model.TeamSettingsUpdate{})
+	now := time.Now()
+	tests := []struct {
+		name string
+		u    model.Unavailability
+		err  error
+	}{
+		{"ends before start", model.Unavailability{UserID: "u1", StartsAt: now.Add(time.Hour), EndsAt: now}, ErrBadPeriod},
+		{"empty period", model.Unavailability{UserID: "u1", StartsAt: now.Add(time.Hour), EndsAt: now.Add(time.Hour)}, ErrBadPeriod},
+		{"already ended", model.Unavailability{UserID: "u1", StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)}, ErrBadPeriod},
+		{"unknown user", model.Unavailability{UserID: "nobody", StartsAt: now, EndsAt: now.Add(time.Hour)}, sql.ErrNoRows},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.AddUnavailability(ctx, tt.u); !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	added, err := s.AddUnavailability(ctx, model.Unavailability{UserID: "u1", StartsAt: now, EndsAt: now.Add(time.Hour), Reason: "vacation"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.ListUnavailability(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != added.ID || list[0].Reason != "vacation" {
+		t.Fatalf("list = %+v", list)
+	}
+	if err := s.RemoveUnavailability(ctx, "u1", added.ID); err != nil {
+		t.Fatal(err)
+	}
+	if list, err = s.ListUnavailability(ctx, "u1"); err != nil || len(list) != 0 {
+		t.Errorf("after remove: list = %+v, err = %v", list, err)
+	}
+}
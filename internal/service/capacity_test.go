@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+func TestCapacityLimitsCandidates(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("u1", true), member("u2", true), member("u3", true), member("u4", true)}, model.TeamSettingsUpdate{})
+	if _, err := s.SetUserCapacity(ctx, "u4", intPtr(0)); err != nil {
+		t.Fatal(err)
+	}
+	pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "u1"}, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(sortedReviewers(pr), []string{"u2", "u3"}) {
+		t.Fatalf("reviewers = %v, want [u2 u3]", pr.AssignedReviewers)
+	}
+
+	c, err := s.SetUserCapacity(ctx, "u3", intPtr(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxOpenReviews == nil || *c.MaxOpenReviews != 1 || c.OpenReviews != 1 {
+		t.Errorf("capacity = %+v, want max 1 with 1 open", c)
+	}
+	p := s.newPlan()
+	pools, err := s.candidatePools(ctx, p, "backend", "u1", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPools(t, pools, "u1", []wantPool{
+		{"backend", false, true, []string{}},
+		{"backend", false, false, []string{"u2"}},
+	})
+	checkExcluded(t, p, map[string]string{
+		"u1": model.ExcludedAuthor,
+		"u3": model.ExcludedAtCapacity,
+		"u4": model.ExcludedAtCapacity,
+	})
+
+	// nil removes the limit.
+	c, err = s.SetUserCapacity(ctx, "u4", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxOpenReviews != nil {
+		t.Errorf("capacity = %+v, want no limit", c)
+	}
+	p = s.newPlan()
+	pools, err = s.candidatePools(ctx, p, "backend", "u1", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := poolIDs(pools[1]); !equalStrings(got, []string{"u2", "u4"}) {
+		t.Errorf("candidates = %v, want [u2 u4]", got)
+	}
+
+	if _, err := s.SetUserCapacity(ctx, "u2", intPtr(-1)); !errors.Is(err, ErrBadCapacity) {
+		t.Errorf("negative: err = %v, want ErrBadCapacity", err)
+	}
+}
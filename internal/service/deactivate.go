@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ilya2044/avito2025/internal/model"
+	"github.com/ilya2044/avito2025/internal/storage"
+)
+
+// Deactivation lists the open reviews handed over to someone else and
+// the ones that stay with the deactivated user for lack of candidates.
+type Deactivation struct {
+	Reassigned []model.Reassignment `json:"reassigned"`
+	Failed     []model.Reassignment `json:"failed"`
+}
+
+// DeactivateUser marks the user inactive and reassigns their reviews of
+// OPEN pull requests the way ReassignReviewer does, all in one write.
+func (s *Service) DeactivateUser(ctx context.Context, userID string) (model.User, Deactivation, error) {
+	if _, err := s.Repo.GetUser(ctx, userID); err != nil {
+		return model.User{}, Deactivation{}, err
+	}
+	d, err := s.deactivate(ctx, []string{userID})
+	if err != nil {
+		return model.User{}, Deactivation{}, err
+	}
+	u, err := s.Repo.GetUser(ctx, userID)
+	return u, d, err
+}
+
+// DeactivateUsers does what DeactivateUser does for the listed users and
+// every member of teamName, if set, in a single write.
+func (s *Service) DeactivateUsers(ctx context.Context, userIDs []string, teamName string) ([]model.User, Deactivation, error) {
+	ids := []string{}
+	seen := map[string]bool{}
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, id := range userIDs {
+		add(id)
+	}
+	if teamName != "" {
+		if _, err := s.Repo.GetTeamSettings(ctx, teamName); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, Deactivation{}, fmt.Errorf("%w: %s", ErrTeamNotFound, teamName)
+			}
+			return nil, Deactivation{}, err
+		}
+		team, err := s.Repo.GetTeam(ctx, teamName)
+		if err != nil {
+			return nil, Deactivation{}, err
+		}
+		for _, m := range team.Members {
+			add(m.UserID)
+		}
+	}
+	users, err := s.Repo.GetUsers(ctx, ids)
+	if err != nil {
+		return nil, Deactivation{}, err
+	}
+	if len(users) != len(ids) {
+		found := map[string]bool{}
+		for _, u := range users {
+			found[u.UserID] = true
+		}
+		missing := []string{}
+		for _, id := range ids {
+			if !found[id] {
+				missing = append(missing, id)
+			}
+		}
+		return nil, Deactivation{}, fmt.Errorf("%w: %s", ErrUserNotFound, strings.Join(missing, ", "))
+	}
+	d, err := s.deactivate(ctx, ids)
+	if err != nil {
+		return nil, Deactivation{}, err
+	}
+	users, err = s.Repo.GetUsers(ctx, ids)
+	return users, d, err
+}
+
+func (s *Service) deactivate(ctx context.Context, userIDs []string) (Deactivation, error) {
+	var d Deactivation
+	err := retryStatus(func() error {
+		return s.retryRotation(func() error {
+			p := s.newPlan()
+			var repls []storage.Replacement
+			var decs []model.Decision
+			var err error
+			d, repls, decs, err = s.planDeactivation(ctx, p, userIDs)
+			if err != nil {
+				return err
+			}
+			return s.Repo.DeactivateUsers(ctx, userIDs, repls, p.rotations(), decs)
+		})
+	})
+	return d, err
+}
+
+// planDeactivation picks replacements for every OPEN review of the users
+// and records a decision for each. None of the users is picked as a
+// replacement. The pull requests and
+// users are read in batches and the plan caches the rest, so the number
+// of queries does not grow with the number of pull requests.
+func (s *Service) planDeactivation(ctx context.Context, p *assignPlan, userIDs []string) (Deactivation, []storage.Replacement, []model.Decision, error) {
+	d := Deactivation{Reassigned: []model.Reassignment{}, Failed: []model.Reassignment{}}
+	prs, err := s.Repo.GetOpenPullRequestsByReviewers(ctx, userIDs)
+	if err != nil {
+		return d, nil, nil, err
+	}
+	authors := []string{}
+	for _, pr := range prs {
+		authors = append(authors, pr.AuthorID)
+	}
+	if err := p.loadUsers(ctx, append(append([]string{}, userIDs...), authors...)); err != nil {
+		return d, nil, nil, err
+	}
+	if err := p.loadRecentReviews(ctx, authors); err != nil {
+		return d, nil, nil, err
+	}
+	leaving := map[string]bool{}
+	for _, id := range userIDs {
+		leaving[id] = true
+	}
+	repls := []storage.Replacement{}
+	decs := []model.Decision{}
+	for _, pr := range prs {
+		for _, uid := range append([]string{}, pr.AssignedReviewers...) {
+			if !leaving[uid] {
+				continue
+			}
+			ra := model.Reassignment{PullRequestID: pr.PullRequestID, OldUserID: uid}
+			mark := p.mark()
+			repl, err := s.planReplacement(ctx, p, pr, uid, userIDs)
+			if errors.Is(err, ErrNoCandidate) {
+				ra.Reason = "no active replacement candidate"
+				d.Failed = append(d.Failed, ra)
+				continue
+			}
+			if err != nil {
+				return d, nil, nil, err
+			}
+			// A second leaving reviewer of the same pull request must
+			// not get the same replacement.
+			pr.AssignedReviewers = append(pr.AssignedReviewers, repl.UserID)
+			repls = append(repls, storage.Replacement{PullRequestID: pr.PullRequestID, OldUserID: uid, New: repl})
+			dec := p.decision(pr.PullRequestID, model.ActionDeactivate, mark)
+			dec.ReplacedUserID = uid
+			decs = append(decs, dec)
+			ra.ReplacedBy = repl.UserID
+			d.Reassigned = append(d.Reassigned, ra)
+		}
+	}
+	return d, repls, decs, nil
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/migrations"
+	"github.com/ilya2044/avito2025/internal/model"
+	"github.com/ilya2044/avito2025/internal/storage"
+)
+
+func TestDeactivateUser(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("a", true), member("u1", true), member("u2", true), member("u3", true)},
+		model.TeamSettingsUpdate{MinReviewers: intPtr(0), MaxReviewers: intPtr(3)})
+	if _, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "a"}, CreateOptions{ReviewersCount: intPtr(2)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-2", PullRequestName: "x", AuthorID: "a"}, CreateOptions{ReviewersCount: intPtr(3)}); err != nil {
+		t.Fatal(err)
+	}
+	pr1, err := s.Repo.GetPullRequest(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaving := pr1.AssignedReviewers[0]
+
+	u, d, err := s.DeactivateUser(ctx, leaving)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.IsActive {
+		t.Errorf("%s is still active", leaving)
+	}
+	// pr-1 has a free user to hand the review to, pr-2 already has
+	// everyone.
+	if len(d.Reassigned) != 1 || d.Reassigned[0].PullRequestID != "pr-1" || d.Reassigned[0].OldUserID != leaving {
+		t.Fatalf("reassigned = %+v", d.Reassigned)
+	}
+	if len(d.Failed) != 1 || d.Failed[0].PullRequestID != "pr-2" || d.Failed[0].Reason == "" {
+		t.Fatalf("failed = %+v", d.Failed)
+	}
+
+	pr1, err = s.Repo.GetPullRequest(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsUser(pr1.AssignedReviewers, leaving) || !containsUser(pr1.AssignedReviewers, d.Reassigned[0].ReplacedBy) {
+		t.Errorf("pr-1 reviewers = %v, want %s replaced by %s", pr1.AssignedReviewers, leaving, d.Reassigned[0].ReplacedBy)
+	}
+	pr2, err := s.Repo.GetPullRequest(ctx, "pr-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsUser(pr2.AssignedReviewers, leaving) {
+		t.Errorf("pr-2 reviewers = %v, %s must stay without a replacement", pr2.AssignedReviewers, leaving)
+	}
+
+	decs, err := s.ListDecisions(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := decs[len(decs)-1]; last.Action != model.ActionDeactivate || last.ReplacedUserID != leaving {
+		t.Errorf("last decision = %+v, want a deactivate replacing %s", last, leaving)
+	}
+
+	if _, _, err := s.DeactivateUser(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown user: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestDeactivateUsers(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "qa", []model.TeamMember{member("q1", true), member("q2", true)}, model.TeamSettingsUpdate{})
+	createTeam(t, s, "backend", []model.TeamMember{member("a", true), member("u1", true), member("u2", true), member("u3", true), member("u4", true)},
+		model.TeamSettingsUpdate{MaxReviewers: intPtr(2)})
+	pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "a"}, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both reviewers of pr-1 leave at once and get different
+	// replacements, neither of them a leaving user.
+	leaving := append([]string{}, pr.AssignedReviewers...)
+	users, d, err := s.DeactivateUsers(ctx, leaving, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].IsActive || users[1].IsActive {
+		t.Fatalf("users = %+v", users)
+	}
+	if len(d.Reassigned) != 2 || len(d.Failed) != 0 {
+		t.Fatalf("deactivation = %+v", d)
+	}
+	pr, err = s.Repo.GetPullRequest(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.AssignedReviewers) != 2 || pr.AssignedReviewers[0] == pr.AssignedReviewers[1] {
+		t.Fatalf("reviewers = %v", pr.AssignedReviewers)
+	}
+	for _, id := range pr.AssignedReviewers {
+		if containsUser(leaving, id) {
+			t.Errorf("reviewers = %v, %s is leaving", pr.AssignedReviewers, id)
+		}
+	}
+
+	// A whole team together with a listed user; the team's members are
+	// not listed twice.
+	users, _, err = s.DeactivateUsers(ctx, []string{"q1", "a"}, "qa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 {
+		t.Errorf("got %d users, want q1, a and q2", len(users))
+	}
+	for _, u := range users {
+		if u.IsActive {
+			t.Errorf("%s is still active", u.UserID)
+		}
+	}
+
+	if _, _, err := s.DeactivateUsers(ctx, []string{"u1", "nobody"}, ""); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unknown user: err = %v, want ErrUserNotFound", err)
+	}
+	if _, _, err := s.DeactivateUsers(ctx, nil, "nobody"); !errors.Is(err, ErrTeamNotFound) {
+		t.Errorf("unknown team: err = %v, want ErrTeamNotFound", err)
+	}
+	u1, err := s.Repo.GetUser(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if containsUser(leaving, "u1") == u1.IsActive {
+		t.Errorf("u1 active = %v after a failed request", u1.IsActive)
+	}
+}
+
+// benchTeams, benchMembers and benchPRs size the data of
+// BenchmarkDeactivateUsers: the first benchLeaving members of every team
+// leave, a hundred users reviewing most of the pull requests.
+const (
+	benchTeams   = 10
+	benchMembers = 30
+	benchLeaving = 10
+	benchPRs     = 4000
+)
+
+// fillBenchStore creates the teams and OPEN pull requests of
+// BenchmarkDeactivateUsers and returns the users who leave.
+func fillBenchStore(b *testing.B, st storage.Store) []string {
+	b.Helper()
+	ctx := context.Background()
+	leaving := []string{}
+	for t := 0; t < benchTeams; t++ {
+		team := model.Team{TeamName: fmt.Sprintf("team-%d", t)}
+		for m := 0; m < benchMembers; m++ {
+			id := fmt.Sprintf("u-%d-%d", t, m)
+			team.Members = append(team.Members, model.TeamMember{UserID: id, Username: id, IsActive: true, Weight: model.DefaultWeight})
+			if m < benchLeaving {
+				leaving = append(leaving, id)
+			}
+		}
+		if err := st.CreateTeam(ctx, team); err != nil {
+			b.Fatal(err)
+		}
+	}
+	for i := 0; i < benchPRs; i++ {
+		t, m := i%benchTeams, i/benchTeams%benchMembers
+		user := func(k int) string { return fmt.Sprintf("u-%d-%d", t, (m+k)%benchMembers) }
+		pr := model.PullRequest{PullRequestID: fmt.Sprintf("pr-%d", i), PullRequestName: "x", AuthorID: user(0)}
+		assigned := []storage.Assignment{{UserID: user(1)}, {UserID: user(2)}}
+		if err := st.CreatePullRequest(ctx, pr, assigned, nil, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return leaving
+}
+
+// BenchmarkDeactivateUsers measures one bulk deactivation of a hundred
+// users with a few thousand open reviews between them.
+func BenchmarkDeactivateUsers(b *testing.B) {
+	bench := func(b *testing.B, open func(b *testing.B) (storage.Store, []string)) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			st, leaving := open(b)
+			s := NewService(st)
+			s.Seeds = NewSeeder(1)
+			b.StartTimer()
+			_, d, err := s.DeactivateUsers(context.Background(), leaving, "")
+			b.StopTimer()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(d.Reassigned) == 0 {
+				b.Fatal("nothing reassigned")
+			}
+			st.Close()
+		}
+	}
+	b.Run("memory", func(b *testing.B) {
+		bench(b, func(b *testing.B) (storage.Store, []string) {
+			st := storage.NewMemoryStore()
+			return st, fillBenchStore(b, st)
+		})
+	})
+	b.Run("sqlite", func(b *testing.B) {
+		// The database is filled once and copied for every run.
+		dir := b.TempDir()
+		tmpl := filepath.Join(dir, "template.sqlite")
+		st := openBenchSQLite(b, tmpl)
+		leaving := fillBenchStore(b, st)
+		st.Close()
+		data, err := os.ReadFile(tmpl)
+		if err != nil {
+			b.Fatal(err)
+		}
+		n := 0
+		bench(b, func(b *testing.B) (storage.Store, []string) {
+			n++
+			path := filepath.Join(dir, fmt.Sprintf("run-%d.sqlite", n))
+			if err := os.WriteFile(path, data, 0o600); err != nil {
+				b.Fatal(err)
+			}
+			return openBenchSQLite(b, path), leaving
+		})
+	})
+}
+
+func openBenchSQLite(b *testing.B, path string) storage.Store {
+	b.Helper()
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate", path))
+	if err != nil {
+		b.Fatal(err)
+	}
+	runner, err := migrations.NewRunner(db, migrations.SQLite)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := runner.Up(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+	return storage.NewSQLiteRepository(db)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+// Seeder hands out the seeds of reviewer draws. Every draw gets its own
+// *rand.Rand from its seed, so no source is shared between goroutines
+// and a recorded draw can be replayed from its seed.
+type Seeder interface {
+	NextSeed() int64
+}
+
+// NewSeeder returns a goroutine-safe Seeder whose sequence of seeds is
+// fixed by seed.
+func NewSeeder(seed int64) Seeder {
+	return &lockedSeeder{r: rand.New(rand.NewSource(seed))}
+}
+
+type lockedSeeder struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (s *lockedSeeder) NextSeed() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Int63()
+}
+
+// ListDecisions returns how the reviewers of the pull request were
+// picked, oldest decision first. Every draw is replayed and marked with
+// whether it still gives the recorded result.
+func (s *Service) ListDecisions(ctx context.Context, prID string) ([]model.Decision, error) {
+	if _, err := s.Repo.GetPullRequest(ctx, prID); err != nil {
+		return nil, err
+	}
+	decs, err := s.Repo.ListDecisions(ctx, prID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range decs {
+		for j := range decs[i].Draws {
+			d := &decs[i].Draws[j]
+			ok := s.reproduces(*d)
+			d.Reproduced = &ok
+		}
+	}
+	return decs, nil
+}
+
+// ReplayDraw runs the draw's selector again on the recorded inputs.
+func (s *Service) ReplayDraw(d model.Draw) ([]string, error) {
+	sel, ok := s.Selectors[d.Strategy]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown assignment_strategy %q", ErrBadSettings, d.Strategy)
+	}
+	in := Selection{Team: d.Team, N: d.N, Rand: rand.New(rand.NewSource(d.Seed)), Cursor: d.Cursor}
+	for _, c := range d.Candidates {
+		in.Candidates = append(in.Candidates, Candidate{
+			User:          model.User{UserID: c.UserID, Weight: c.Weight, Tier: c.Tier},
+			OpenReviews:   c.OpenReviews,
+			RecentReviews: c.RecentReviews,
+		})
+	}
+	ids := []string{}
+	for _, u := range sel.Select(in) {
+		ids = append(ids, u.UserID)
+	}
+	return ids, nil
+}
+
+func (s *Service) reproduces(d model.Draw) bool {
+	ids, err := s.ReplayDraw(d)
+	if err != nil || len(ids) != len(d.Picked) {
+		return false
+	}
+	for i := range ids {
+		if ids[i] != d.Picked[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// planMark is a position in what a plan recorded, so the draws and
+// exclusions of one pull request can be told apart in a plan covering
+// many.
+type planMark struct {
+	draws, excluded int
+}
+
+func (p *assignPlan) mark() planMark {
+	return planMark{draws: len(p.draws), excluded: len(p.excluded)}
+}
+
+// decision wraps what the plan recorded since mark.
+func (p *assignPlan) decision(prID, action string, mark planMark) model.Decision {
+	return model.Decision{
+		PullRequestID: prID,
+		Action:        action,
+		Draws:         append([]model.Draw{}, p.draws[mark.draws:]...),
+		Excluded:      append([]model.Exclusion{}, p.excluded[mark.excluded:]...),
+	}
+}
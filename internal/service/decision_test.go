@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+func TestReplayRecordedDecisions(t *testing.T) {
+	ctx := context.Background()
+	strategies := []string{model.StrategyRandom, model.StrategyLeastLoaded, model.StrategyRoundRobin, model.StrategyWeighted}
+	for _, strategy := range strategies {
+		t.Run(strategy, func(t *testing.T) {
+			s := newTestService()
+			members := []model.TeamMember{}
+			for i := 1; i <= 6; i++ {
+				m := member(fmt.Sprintf("u%d", i), true)
+				m.Weight = float64(i)
+				members = append(members, m)
+			}
+			createTeam(t, s, "backend", members, model.TeamSettingsUpdate{AssignmentStrategy: &strategy})
+			for i := 0; i < 5; i++ {
+				pr := model.PullRequest{PullRequestID: fmt.Sprintf("pr-%d", i), PullRequestName: "x", AuthorID: fmt.Sprintf("u%d", i%2+1)}
+				if _, err := s.CreatePullRequest(ctx, pr, CreateOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// A service with another seed sequence must still replay the
+			// stored draws.
+			replayer := NewService(s.Repo)
+			replayer.Seeds = NewSeeder(2)
+			for i := 0; i < 5; i++ {
+				decs, err := replayer.ListDecisions(ctx, fmt.Sprintf("pr-%d", i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(decs) != 1 || len(decs[0].Draws) == 0 {
+					t.Fatalf("pr-%d: unexpected decisions %+v", i, decs)
+				}
+				for _, d := range decs[0].Draws {
+					got, err := replayer.ReplayDraw(d)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !equalStrings(got, d.Picked) {
+						t.Errorf("pr-%d: replay picked %v, recorded %v", i, got, d.Picked)
+					}
+					if d.Reproduced == nil || !*d.Reproduced {
+						t.Errorf("pr-%d: draw not marked reproduced", i)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestReplayStoredDraw pins the picks of draws as they were recorded, so
+// a change to a selector that would stop old decisions from replaying
+// fails here.
+func TestReplayStoredDraw(t *testing.T) {
+	cands := []model.DrawCandidate{
+		{UserID: "u2", OpenReviews: 1, RecentReviews: 0, Weight: 1},
+		{UserID: "u3", OpenReviews: 0, RecentReviews: 2, Weight: 2},
+		{UserID: "u4", OpenReviews: 3, RecentReviews: 1, Weight: 1, Tier: model.TierSenior},
+		{UserID: "u5", OpenReviews: 0, RecentReviews: 0, Weight: 0.5},
+	}
+	tests := []struct {
+		strategy string
+		cursor   string
+		picked   []string
+	}{
+		{model.StrategyRandom, "", []string{"u5", "u2"}},
+		{model.StrategyLeastLoaded, "", []string{"u5", "u3"}},
+		{model.StrategyRoundRobin, "u3", []string{"u4", "u5"}},
+		{model.StrategyWeighted, "", []string{"u5", "u2"}},
+	}
+	s := newTestService()
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			d := model.Draw{Team: "backend", Strategy: tt.strategy, Seed: 7, N: 2, Cursor: tt.cursor, Candidates: cands, Picked: tt.picked}
+			got, err := s.ReplayDraw(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalStrings(got, tt.picked) {
+				t.Errorf("replay picked %v, recorded %v", got, tt.picked)
+			}
+			if !s.reproduces(d) {
+				t.Error("draw not reproduced")
+			}
+		})
+	}
+}
+
+func TestReplayUnknownStrategy(t *testing.T) {
+	s := newTestService()
+	d := model.Draw{Strategy: "nope", Seed: 1, N: 1, Picked: []string{"u1"}}
+	if _, err := s.ReplayDraw(d); err == nil {
+		t.Fatal("expected an error")
+	}
+	if s.reproduces(d) {
+		t.Error("unknown strategy reported as reproduced")
+	}
+}
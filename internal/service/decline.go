@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ilya2044/avito2025/internal/model"
+	"github.com/ilya2044/avito2025/internal/storage"
+)
+
+// DeclineReview lets an assigned reviewer turn down an OPEN pull request.
+// Someone else is picked as by ReassignReviewer, and the decline is kept
+// so the reviewer is not assigned to the pull request again. If nobody
+// can take over, the reviewer is still unassigned and the slot stays
+// empty. It returns the updated pull request and the new reviewer, empty
+// in that case.
+func (s *Service) DeclineReview(ctx context.Context, prID, userID, reason string) (model.PullRequest, string, error) {
+	var new string
+	err := retryStatus(func() error {
+		pr, err := s.Repo.GetPullRequest(ctx, prID)
+		if err != nil {
+			return err
+		}
+		if err := requireOpen(pr); err != nil {
+			return err
+		}
+		pr.Declines = append(pr.Declines, model.Decline{UserID: userID, Reason: reason})
+		return s.retryRotation(func() error {
+			p := s.newPlan()
+			var to *storage.Assignment
+			repl, err := s.planReplacement(ctx, p, pr, userID, nil)
+			switch {
+			case err == nil:
+				to = &repl
+			case !errors.Is(err, ErrNoCandidate):
+				return err
+			}
+			new = repl.UserID
+			dec := p.decision(prID, model.ActionDecline, planMark{})
+			dec.ReplacedUserID = userID
+			d := model.Decline{UserID: userID, Reason: reason}
+			return s.Repo.DeclineReview(ctx, prID, d, to, p.rotations(), []model.Decision{dec})
+		})
+	})
+	if err != nil {
+		return model.PullRequest{}, "", err
+	}
+	updatedPR, err := s.Repo.GetPullRequest(ctx, prID)
+	return updatedPR, new, err
+}
+
+// declined maps the users who declined pr to the reason they are left
+// out of its candidate pools.
+func declined(pr model.PullRequest) map[string]string {
+	res := map[string]string{}
+	for _, d := range pr.Declines {
+		res[d.UserID] = model.ExcludedDeclined
+	}
+	return res
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+func TestDeclineReview(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("u1", true), member("u2", true), member("u3", true)}, model.TeamSettingsUpdate{})
+	pr := model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "u1"}
+	if _, err := s.CreatePullRequest(ctx, pr, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, replacedBy, err := s.DeclineReview(ctx, "pr-1", "u2", "busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacedBy != "" {
+		t.Errorf("replaced by %q, want nobody", replacedBy)
+	}
+	if !equalStrings(got.AssignedReviewers, []string{"u3"}) {
+		t.Errorf("reviewers = %v, want [u3]", got.AssignedReviewers)
+	}
+	if len(got.Declines) != 1 || got.Declines[0].UserID != "u2" || got.Declines[0].Reason != "busy" {
+		t.Errorf("declines = %+v", got.Declines)
+	}
+
+	got, replacedBy, err = s.DeclineReview(ctx, "pr-1", "u3", "on vacation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacedBy != "" || len(got.AssignedReviewers) != 0 || len(got.Declines) != 2 {
+		t.Errorf("replaced by %q, reviewers %v, declines %+v", replacedBy, got.AssignedReviewers, got.Declines)
+	}
+
+	if _, _, err := s.DeclineReview(ctx, "pr-1", "u3", "again"); !errors.Is(err, ErrNotAssigned) {
+		t.Errorf("err = %v, want ErrNotAssigned", err)
+	}
+
+	decs, err := s.ListDecisions(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	declines := 0
+	for _, d := range decs {
+		if d.Action == model.ActionDecline {
+			declines++
+		}
+	}
+	if declines != 2 {
+		t.Errorf("got %d decline decisions, want 2", declines)
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+// Explanation tells for every assigned reviewer of a pull request how
+// they were picked.
+type Explanation struct {
+	PullRequestID string                `json:"pull_request_id"`
+	AuthorID      string                `json:"author_id"`
+	Status        string                `json:"status"`
+	Reviewers     []ReviewerExplanation `json:"reviewers"`
+}
+
+// ReviewerExplanation is the draw that picked a reviewer: the strategy,
+// the candidates it chose from and who was left out of the pools and
+// why. Requested is set instead for a reviewer named explicitly, and
+// Note when no recorded decision picked them.
+type ReviewerExplanation struct {
+	UserID     string                `json:"user_id"`
+	DecisionID int64                 `json:"decision_id,omitempty"`
+	Action     string                `json:"action,omitempty"`
+	Team       string                `json:"team,omitempty"`
+	Strategy   string                `json:"strategy,omitempty"`
+	Fallback   bool                  `json:"fallback,omitempty"`
+	Owners     bool                  `json:"owners,omitempty"`
+	Senior     bool                  `json:"senior,omitempty"`
+	Requested  bool                  `json:"requested,omitempty"`
+	Candidates []model.DrawCandidate `json:"candidates,omitempty"`
+	Excluded   []model.Exclusion     `json:"excluded,omitempty"`
+	Note       string                `json:"note,omitempty"`
+}
+
+// ExplainPullRequest explains the current reviewers from the latest
+// recorded decision that picked or named each of them.
+func (s *Service) ExplainPullRequest(ctx context.Context, prID string) (Explanation, error) {
+	pr, err := s.Repo.GetPullRequest(ctx, prID)
+	if err != nil {
+		return Explanation{}, err
+	}
+	decs, err := s.Repo.ListDecisions(ctx, prID)
+	if err != nil {
+		return Explanation{}, err
+	}
+	ex := Explanation{PullRequestID: pr.PullRequestID, AuthorID: pr.AuthorID, Status: pr.Status, Reviewers: []ReviewerExplanation{}}
+	for _, uid := range pr.AssignedReviewers {
+		ex.Reviewers = append(ex.Reviewers, explainReviewer(decs, uid))
+	}
+	return ex, nil
+}
+
+func explainReviewer(decs []model.Decision, userID string) ReviewerExplanation {
+	for i := len(decs) - 1; i >= 0; i-- {
+		dec := decs[i]
+		if containsUser(dec.Requested, userID) {
+			return ReviewerExplanation{UserID: userID, DecisionID: dec.ID, Action: dec.Action, Requested: true}
+		}
+		for _, d := range dec.Draws {
+			if !containsUser(d.Picked, userID) {
+				continue
+			}
+			return ReviewerExplanation{
+				UserID:     userID,
+				DecisionID: dec.ID,
+				Action:     dec.Action,
+				Team:       d.Team,
+				Strategy:   d.Strategy,
+				Fallback:   d.Fallback,
+				Owners:     d.Owners,
+				Senior:     d.Senior,
+				Candidates: d.Candidates,
+				Excluded:   dec.Excluded,
+			}
+		}
+	}
+	return ReviewerExplanation{UserID: userID, Note: "no recorded assignment decision"}
+}
+
+func containsUser(ids []string, userID string) bool {
+	for _, id := range ids {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+// compileOwnershipPattern turns a CODEOWNERS-style pattern into a regexp
+// over slash separated paths. As in CODEOWNERS, a pattern containing a
+// slash is anchored at the repository root, one without a slash matches
+// at any depth, a trailing slash matches only directories, * and ? stay
+// within a path segment and ** spans segments. A pattern also matches
+// everything below a directory it names, except for a trailing /*.
+func compileOwnershipPattern(pattern string) (*regexp.Regexp, error) {
+	p := strings.TrimSpace(pattern)
+	dirOnly := strings.HasSuffix(p, "/")
+	p = strings.TrimSuffix(p, "/")
+	anchored := strings.Contains(p, "/")
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return nil, fmt.Errorf("empty pattern %q", pattern)
+	}
+	var b strings.Builder
+	if anchored {
+		b.WriteString("^")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(p); i++ {
+		switch {
+		case strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case p[i] == '*':
+			b.WriteString("[^/]*")
+		case p[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	switch {
+	case dirOnly:
+		b.WriteString("/.*$")
+	case strings.HasSuffix(p, "/*"):
+		// docs/* covers the files right in docs, not its subdirectories.
+		b.WriteString("$")
+	default:
+		b.WriteString("(?:/.*)?$")
+	}
+	return regexp.Compile(b.String())
+}
+
+func validateOwnershipRules(rules []model.OwnershipRule) error {
+	for _, rule := range rules {
+		if _, err := compileOwnershipPattern(rule.Pattern); err != nil {
+			return fmt.Errorf("%w: ownership rule: %v", ErrBadSettings, err)
+		}
+		if len(rule.Owners) == 0 {
+			return fmt.Errorf("%w: ownership rule %s has no owners", ErrBadSettings, rule.Pattern)
+		}
+		for _, o := range rule.Owners {
+			if o == "" || strings.ContainsAny(o, " \t\n") {
+				return fmt.Errorf("%w: ownership rule %s has invalid owner %q", ErrBadSettings, rule.Pattern, o)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeFiles cleans the changed paths of a pull request, drops empty
+// ones and duplicates, and sorts them.
+func normalizeFiles(files []string) []string {
+	seen := map[string]bool{}
+	res := []string{}
+	for _, f := range files {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		f = strings.TrimPrefix(path.Clean("/"+f), "/")
+		if f == "" || seen[f] {
+			continue
+		}
+		seen[f] = true
+		res = append(res, f)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// fileOwners returns the owners of the files under the rules. For every
+// file only the last matching rule counts, as in CODEOWNERS.
+func fileOwners(rules []model.OwnershipRule, files []string) map[string]bool {
+	owners := map[string]bool{}
+	if len(rules) == 0 || len(files) == 0 {
+		return owners
+	}
+	res := make([]*regexp.Regexp, len(rules))
+	for i, rule := range rules {
+		// Rules are validated when stored, a broken one just never
+		// matches.
+		res[i], _ = compileOwnershipPattern(rule.Pattern)
+	}
+	for _, f := range files {
+		for i := len(rules) - 1; i >= 0; i-- {
+			if res[i] != nil && res[i].MatchString(f) {
+				for _, o := range rules[i].Owners {
+					owners[o] = true
+				}
+				break
+			}
+		}
+	}
+	return owners
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+func TestCompileOwnershipPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "internal/service/assign.go", true},
+		{"*.go", "main.gox", false},
+		{"docs", "docs/readme.md", true},
+		{"docs", "web/docs/index.html", true},
+		{"docs", "docsite/index.html", false},
+		{"/docs", "docs/readme.md", true},
+		{"/docs", "web/docs/index.html", false},
+		{"api/", "api/handlers.go", true},
+		{"api/", "web/api/client.js", true},
+		{"api/", "api", false},
+		{"internal/api", "internal/api/handlers.go", true},
+		{"internal/api", "cmd/internal/api/x.go", false},
+		{"docs/*", "docs/readme.md", true},
+		{"docs/*", "docs/img/logo.png", false},
+		{"internal/*.go", "internal/x.go", true},
+		{"internal/*.go", "internal/service/x.go", false},
+		{"**/migrations", "internal/migrations/0001.sql", true},
+		{"**/migrations", "migrations/0001.sql", true},
+		{"internal/**/*.sql", "internal/migrations/postgres/0001.sql", true},
+		{"internal/**/*.sql", "internal/x.sql", true},
+		{"internal/**/*.sql", "cmd/x.sql", false},
+		{"v?.txt", "v1.txt", true},
+		{"v?.txt", "v10.txt", false},
+		{"a.b", "axb", false},
+		{" Makefile ", "Makefile", true},
+	}
+	for _, tt := range tests {
+		re, err := compileOwnershipPattern(tt.pattern)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.pattern, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.match {
+			t.Errorf("%q on %q = %v, want %v", tt.pattern, tt.path, got, tt.match)
+		}
+	}
+
+	for _, pattern := range []string{"", " ", "/", "//"} {
+		if _, err := compileOwnershipPattern(pattern); err == nil {
+			t.Errorf("%q: want an error", pattern)
+		}
+	}
+}
+
+func TestFileOwners(t *testing.T) {
+	rules := []model.OwnershipRule{
+		{Pattern: "*.go", Owners: []string{"go"}},
+		{Pattern: "docs/", Owners: []string{"writer"}},
+		{Pattern: "internal/storage", Owners: []string{"db1", "db2"}},
+	}
+	tests := []struct {
+		files []string
+		want  []string
+	}{
+		{nil, []string{}},
+		{[]string{"README.md"}, []string{}},
+		{[]string{"main.go", "docs/x.md"}, []string{"go", "writer"}},
+		// Only the last matching rule counts.
+		{[]string{"internal/storage/memory.go"}, []string{"db1", "db2"}},
+	}
+	for _, tt := range tests {
+		got := []string{}
+		for o := range fileOwners(rules, normalizeFiles(tt.files)) {
+			got = append(got, o)
+		}
+		sort.Strings(got)
+		if !equalStrings(got, tt.want) {
+			t.Errorf("%v: owners %v, want %v", tt.files, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeFiles(t *testing.T) {
+	got := normalizeFiles([]string{" b.go ", "./a.go", "", "/a.go", "x/../b.go", "/"})
+	if want := []string{"a.go", "b.go"}; !equalStrings(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestOwnersPool(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	rules := []model.OwnershipRule{{Pattern: "api/", Owners: []string{"u5", "u8"}}}
+	createTeam(t, s, "backend", []model.TeamMember{member("u1", true), member("u2", true), member("u5", true), member("u8", true)},
+		model.TeamSettingsUpdate{OwnershipRules: &rules})
+
+	p := s.newPlan()
+	pools, err := s.candidatePools(ctx, p, "backend", "u1", []string{"api/handlers.go"}, map[string]string{"u8": model.ExcludedReplaced})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPools(t, pools, "u1", []wantPool{
+		{"backend", false, true, []string{"u5"}},
+		{"backend", false, false, []string{"u2"}},
+	})
+	checkExcluded(t, p, map[string]string{"u1": model.ExcludedAuthor, "u8": model.ExcludedReplaced})
+
+	// Owners come first, the rest of the team fills up.
+	pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "u1", Files: []string{"api/handlers.go"}},
+		CreateOptions{ReviewersCount: intPtr(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(sortedReviewers(pr), []string{"u5", "u8"}) {
+		t.Errorf("reviewers = %v, want the owners u5 and u8", pr.AssignedReviewers)
+	}
+
+	bad := []model.OwnershipRule{{Pattern: "api/", Owners: nil}}
+	if _, err := s.UpdateTeamSettings(ctx, "backend", model.TeamSettingsUpdate{OwnershipRules: &bad}); !errors.Is(err, ErrBadSettings) {
+		t.Errorf("no owners: err = %v, want ErrBadSettings", err)
+	}
+	bad = []model.OwnershipRule{{Pattern: "", Owners: []string{"u2"}}}
+	if _, err := s.UpdateTeamSettings(ctx, "backend", model.TeamSettingsUpdate{OwnershipRules: &bad}); !errors.Is(err, ErrBadSettings) {
+		t.Errorf("empty pattern: err = %v, want ErrBadSettings", err)
+	}
+}
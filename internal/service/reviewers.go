@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ilya2044/avito2025/internal/model"
+	"github.com/ilya2044/avito2025/internal/storage"
+)
+
+// AddReviewer assigns the named user to an OPEN pull request on top of
+// its current reviewers. The user must be active and not the author.
+func (s *Service) AddReviewer(ctx context.Context, prID, userID string) (model.PullRequest, error) {
+	err := retryStatus(func() error {
+		pr, err := s.Repo.GetPullRequest(ctx, prID)
+		if err != nil {
+			return err
+		}
+		if err := requireOpen(pr); err != nil {
+			return err
+		}
+		if containsUser(pr.AssignedReviewers, userID) {
+			return fmt.Errorf("%w: %s", ErrAssigned, userID)
+		}
+		if _, err := s.requestedReviewers(ctx, pr.AuthorID, []string{userID}); err != nil {
+			return err
+		}
+		dec := model.Decision{
+			PullRequestID: prID,
+			Action:        model.ActionAdd,
+			Requested:     []string{userID},
+			Draws:         []model.Draw{},
+			Excluded:      []model.Exclusion{},
+		}
+		return s.Repo.AddReviewer(ctx, prID, storage.Assignment{UserID: userID}, []model.Decision{dec})
+	})
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+	return s.Repo.GetPullRequest(ctx, prID)
+}
+
+// RemoveReviewer unassigns a reviewer of an OPEN pull request without
+// picking anyone in their place.
+func (s *Service) RemoveReviewer(ctx context.Context, prID, userID string) (model.PullRequest, error) {
+	err := retryStatus(func() error {
+		pr, err := s.Repo.GetPullRequest(ctx, prID)
+		if err != nil {
+			return err
+		}
+		if err := requireOpen(pr); err != nil {
+			return err
+		}
+		if !containsUser(pr.AssignedReviewers, userID) {
+			return ErrNotAssigned
+		}
+		return s.Repo.RemoveReviewer(ctx, prID, userID)
+	})
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+	return s.Repo.GetPullRequest(ctx, prID)
+}
+
+// requestedReviewers looks up the reviewers named for a pull request of
+// author, dropping duplicates. Each must be active and not the author.
+func (s *Service) requestedReviewers(ctx context.Context, author string, ids []string) ([]model.User, error) {
+	res := []model.User{}
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if id == author {
+			return nil, fmt.Errorf("%w: %s is the author", ErrBadReviewer, id)
+		}
+		u, err := s.Repo.GetUser(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !u.IsActive {
+			return nil, fmt.Errorf("%w: %s is inactive", ErrBadReviewer, id)
+		}
+		res = append(res, u)
+	}
+	return res, nil
+}
+
+func userIDs(users []model.User) []string {
+	ids := make([]string, len(users))
+	for i, u := range users {
+		ids[i] = u.UserID
+	}
+	return ids
+}
+
+func hasSenior(users []model.User) bool {
+	for _, u := range users {
+		if u.Tier == model.TierSenior {
+			return true
+		}
+	}
+	return false
+}
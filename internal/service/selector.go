@@ -0,0 +1,188 @@
+package service
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+// Candidate is an eligible reviewer together with what selectors may use
+// to rank them.
+type Candidate struct {
+	User        model.User
+	OpenReviews int
+	// RecentReviews is how many of the author's latest pull requests,
+	// up to the team's pairing_history, the candidate reviewed.
+	RecentReviews int
+}
+
+// userWeight is the weight set for the candidate, DefaultWeight if none.
+func userWeight(c Candidate) float64 {
+	if c.User.Weight > 0 {
+		return c.User.Weight
+	}
+	return model.DefaultWeight
+}
+
+// pairingWeight down-weights candidates the author keeps getting as
+// reviewers.
+func pairingWeight(c Candidate) float64 {
+	return 1 / float64(1+c.RecentReviews)
+}
+
+// Selection is the input of a ReviewerSelector.
+type Selection struct {
+	Team       string
+	Candidates []Candidate
+	N          int
+	Rand       *rand.Rand
+	// Cursor is the team's persisted rotation position. It is only
+	// loaded for RotatingSelectors.
+	Cursor string
+}
+
+// ReviewerSelector picks up to N reviewers out of the candidates. It must
+// not return the same user twice.
+type ReviewerSelector interface {
+	Select(sel Selection) []model.User
+}
+
+// RotatingSelector is a selector driven by Selection.Cursor. NextCursor
+// tells where the rotation continues after the picked users; the service
+// stores it in the same transaction as the assignment.
+type RotatingSelector interface {
+	ReviewerSelector
+	NextCursor(picked []model.User) string
+}
+
+// DefaultSelectors returns the built-in strategies keyed by the name
+// stored in the team settings.
+func DefaultSelectors() map[string]ReviewerSelector {
+	return map[string]ReviewerSelector{
+		model.StrategyRandom:      RandomSelector{},
+		model.StrategyLeastLoaded: LeastLoadedSelector{},
+		model.StrategyRoundRobin:  RoundRobinSelector{},
+		model.StrategyWeighted:    WeightedSelector{},
+	}
+}
+
+// RandomSelector picks at random in proportion to the users' weights.
+// Candidates who recently reviewed the author have a lower chance: the
+// weight is divided by 1+recent reviews.
+type RandomSelector struct{}
+
+func (RandomSelector) Select(sel Selection) []model.User {
+	return pickN(sel.Candidates, sel.Rand, sel.N)
+}
+
+func pickN(cands []Candidate, r *rand.Rand, n int) []model.User {
+	weights := make([]float64, len(cands))
+	for i, c := range cands {
+		weights[i] = userWeight(c) * pairingWeight(c)
+	}
+	return weightedPick(cands, weights, r, n)
+}
+
+// LeastLoadedSelector prefers candidates with the fewest OPEN reviews.
+// Equal load is broken by fewer recent reviews of the author, then at
+// random.
+type LeastLoadedSelector struct{}
+
+func (LeastLoadedSelector) Select(sel Selection) []model.User {
+	cands := make([]Candidate, len(sel.Candidates))
+	for i, j := range sel.Rand.Perm(len(sel.Candidates)) {
+		cands[i] = sel.Candidates[j]
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		if cands[i].OpenReviews != cands[j].OpenReviews {
+			return cands[i].OpenReviews < cands[j].OpenReviews
+		}
+		return cands[i].RecentReviews < cands[j].RecentReviews
+	})
+	return firstN(cands, sel.N)
+}
+
+// RoundRobinSelector walks the team's active members in user_id order,
+// continuing after the cursor. It spreads reviews by itself and ignores
+// recent pairings.
+type RoundRobinSelector struct{}
+
+func (RoundRobinSelector) Select(sel Selection) []model.User {
+	return rotate(sel.Candidates, sel.Cursor, sel.N)
+}
+
+func (RoundRobinSelector) NextCursor(picked []model.User) string {
+	return picked[len(picked)-1].UserID
+}
+
+// rotate orders candidates by user_id and returns n of them starting
+// right after cursor, wrapping around.
+func rotate(cands []Candidate, cursor string, n int) []model.User {
+	sorted := make([]Candidate, len(cands))
+	copy(sorted, cands)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].User.UserID < sorted[j].User.UserID
+	})
+	start := sort.Search(len(sorted), func(i int) bool {
+		return sorted[i].User.UserID > cursor
+	})
+	return firstN(append(sorted[start:], sorted[:start]...), n)
+}
+
+// WeightedSelector draws at random, giving candidates with fewer OPEN
+// reviews a proportionally higher chance: the user's weight divided by
+// 1+open reviews and by 1+recent reviews of the author.
+type WeightedSelector struct{}
+
+func (WeightedSelector) Select(sel Selection) []model.User {
+	weights := make([]float64, len(sel.Candidates))
+	for i, c := range sel.Candidates {
+		weights[i] = userWeight(c) * pairingWeight(c) / float64(1+c.OpenReviews)
+	}
+	return weightedPick(sel.Candidates, weights, sel.Rand, sel.N)
+}
+
+// weightedPick draws n candidates without replacement, each draw with
+// probability proportional to the remaining weights.
+func weightedPick(cands []Candidate, weights []float64, r *rand.Rand, n int) []model.User {
+	left := make([]Candidate, len(cands))
+	copy(left, cands)
+	w := make([]float64, len(weights))
+	copy(w, weights)
+	res := []model.User{}
+	for len(res) < n && len(left) > 0 {
+		total := 0.0
+		for _, x := range w {
+			total += x
+		}
+		i := len(left) - 1
+		if total > 0 {
+			x := r.Float64() * total
+			for j := range w {
+				if x < w[j] {
+					i = j
+					break
+				}
+				x -= w[j]
+			}
+		} else {
+			i = r.Intn(len(left))
+		}
+		res = append(res, left[i].User)
+		left = append(left[:i], left[i+1:]...)
+		w = append(w[:i], w[i+1:]...)
+	}
+	return res
+}
+
+func firstN(cands []Candidate, n int) []model.User {
+	if n > len(cands) {
+		n = len(cands)
+	}
+	res := make([]model.User, n)
+	for i := 0; i < n; i++ {
+		res[i] = cands[i].User
+	}
+	return res
+}
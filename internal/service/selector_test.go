@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+func cand(id string, open, recent int, weight float64) Candidate {
+	return Candidate{User: model.User{UserID: id, Weight: weight}, OpenReviews: open, RecentReviews: recent}
+}
+
+func TestLeastLoadedSelector(t *testing.T) {
+	tests := []struct {
+		name  string
+		cands []Candidate
+		n     int
+		want  []string
+	}{
+		{"fewest open reviews", []Candidate{cand("a", 3, 0, 1), cand("b", 1, 0, 1), cand("c", 2, 0, 1)}, 2, []string{"b", "c"}},
+		{"one", []Candidate{cand("a", 3, 0, 1), cand("b", 0, 0, 1)}, 1, []string{"b"}},
+		{"fewer candidates than n", []Candidate{cand("a", 0, 0, 1)}, 2, []string{"a"}},
+		{"none", []Candidate{}, 2, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(0); seed < 20; seed++ {
+				got := userIDs(LeastLoadedSelector{}.Select(Selection{Candidates: tt.cands, N: tt.n, Rand: rand.New(rand.NewSource(seed))}))
+				if !equalStrings(got, tt.want) {
+					t.Fatalf("seed %d: got %v, want %v", seed, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLeastLoadedBreaksTiesAtRandom(t *testing.T) {
+	cands := []Candidate{cand("a", 1, 0, 1), cand("b", 1, 0, 1), cand("c", 1, 0, 1), cand("d", 2, 0, 1)}
+	picked := map[string]int{}
+	for seed := int64(0); seed < 300; seed++ {
+		got := LeastLoadedSelector{}.Select(Selection{Candidates: cands, N: 1, Rand: rand.New(rand.NewSource(seed))})
+		picked[got[0].UserID]++
+	}
+	if picked["d"] != 0 {
+		t.Errorf("d picked %d times despite a higher load", picked["d"])
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		if picked[id] < 50 {
+			t.Errorf("%s picked %d of 300 times, ties are not broken at random: %v", id, picked[id], picked)
+		}
+	}
+}
+
+// TestLeastLoadedSpreadsReviews creates pull requests one after another
+// and expects every reviewer to end up with the same load.
+func TestLeastLoadedSpreadsReviews(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{
+		member("a", true), member("u1", true), member("u2", true), member("u3", true), member("u4", true),
+	}, model.TeamSettingsUpdate{})
+	for i := 0; i < 6; i++ {
+		pr := model.PullRequest{PullRequestID: fmt.Sprintf("pr-%d", i), PullRequestName: "x", AuthorID: "a"}
+		if _, err := s.CreatePullRequest(ctx, pr, CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load, err := s.Repo.CountOpenReviews(ctx, []string{"u1", "u2", "u3", "u4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"u1", "u2", "u3", "u4"} {
+		if load[id] != 3 {
+			t.Errorf("%s has %d open reviews, want 3: %v", id, load[id], load)
+		}
+	}
+}
+
+func TestSelectorsPickDistinctUsers(t *testing.T) {
+	cands := []Candidate{cand("a", 0, 0, 1), cand("b", 2, 1, 3), cand("c", 1, 0, 0), cand("d", 5, 2, 1)}
+	for name, sel := range DefaultSelectors() {
+		for _, n := range []int{0, 1, 3, 4, 6} {
+			for seed := int64(0); seed < 20; seed++ {
+				got := sel.Select(Selection{Team: "t", Candidates: cands, N: n, Rand: rand.New(rand.NewSource(seed))})
+				want := min(n, len(cands))
+				if len(got) != want {
+					t.Fatalf("%s n=%d: got %d users, want %d", name, n, len(got), want)
+				}
+				seen := map[string]bool{}
+				for _, u := range got {
+					if seen[u.UserID] {
+						t.Fatalf("%s n=%d: %s picked twice", name, n, u.UserID)
+					}
+					seen[u.UserID] = true
+				}
+			}
+		}
+	}
+}
+
+// drawShares runs sel on cands for many seeds and returns how often each
+// user was picked first.
+func drawShares(sel ReviewerSelector, cands []Candidate) map[string]float64 {
+	const runs = 20000
+	counts := map[string]int{}
+	for seed := int64(0); seed < runs; seed++ {
+		got := sel.Select(Selection{Candidates: cands, N: 1, Rand: rand.New(rand.NewSource(seed))})
+		counts[got[0].UserID]++
+	}
+	shares := map[string]float64{}
+	for id, n := range counts {
+		shares[id] = float64(n) / runs
+	}
+	return shares
+}
+
+type shareCase struct {
+	name  string
+	sel   ReviewerSelector
+	cands []Candidate
+	want  map[string]float64
+}
+
+func checkShares(t *testing.T, tests []shareCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := drawShares(tt.sel, tt.cands)
+			ids := []string{}
+			for id := range tt.want {
+				ids = append(ids, id)
+			}
+			sort.Strings(ids)
+			for _, id := range ids {
+				if d := got[id] - tt.want[id]; d < -0.02 || d > 0.02 {
+					t.Errorf("share of %s = %.3f, want %.3f", id, got[id], tt.want[id])
+				}
+			}
+		})
+	}
+}
+
+func TestRandomAndWeightedDraws(t *testing.T) {
+	checkShares(t, []shareCase{
+		{"random ignores load", RandomSelector{}, []Candidate{cand("a", 0, 0, 1), cand("b", 9, 0, 1)}, map[string]float64{"a": 0.5, "b": 0.5}},
+		{"random three", RandomSelector{}, []Candidate{cand("a", 0, 0, 1), cand("b", 0, 0, 1), cand("c", 0, 0, 1)}, map[string]float64{"a": 0.333, "b": 0.333, "c": 0.333}},
+		{"weighted by load", WeightedSelector{}, []Candidate{cand("a", 0, 0, 1), cand("b", 2, 0, 1)}, map[string]float64{"a": 0.75, "b": 0.25}},
+		{"weighted equal load", WeightedSelector{}, []Candidate{cand("a", 1, 0, 1), cand("b", 1, 0, 1)}, map[string]float64{"a": 0.5, "b": 0.5}},
+	})
+}
+
+// firstSelector picks the candidates with the smallest user_id.
+type firstSelector struct{}
+
+func (firstSelector) Select(sel Selection) []model.User {
+	cands := append([]Candidate{}, sel.Candidates...)
+	sort.Slice(cands, func(i, j int) bool { return cands[i].User.UserID < cands[j].User.UserID })
+	return firstN(cands, sel.N)
+}
+
+func TestTeamStrategy(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	s.Selectors["first"] = firstSelector{}
+	members := []model.TeamMember{member("a", true), member("u4", true), member("u2", true), member("u3", true), member("u1", true)}
+	createTeam(t, s, "backend", members, model.TeamSettingsUpdate{})
+	createTeam(t, s, "frontend", []model.TeamMember{member("b", true)}, model.TeamSettingsUpdate{})
+
+	strategy := "first"
+	if _, err := s.UpdateTeamSettings(ctx, "backend", model.TeamSettingsUpdate{AssignmentStrategy: &strategy}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: fmt.Sprintf("pr-%d", i), PullRequestName: "x", AuthorID: "a"}, CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalStrings(sortedReviewers(pr), []string{"u1", "u2"}) {
+			t.Fatalf("pr-%d reviewers = %v, want [u1 u2]", i, pr.AssignedReviewers)
+		}
+	}
+
+	ts, err := s.Repo.GetTeamSettings(ctx, "frontend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts.AssignmentStrategy != model.StrategyLeastLoaded {
+		t.Errorf("frontend strategy = %q, want the default %q", ts.AssignmentStrategy, model.StrategyLeastLoaded)
+	}
+
+	unknown := "fastest"
+	if _, err := s.UpdateTeamSettings(ctx, "backend", model.TeamSettingsUpdate{AssignmentStrategy: &unknown}); !errors.Is(err, ErrBadSettings) {
+		t.Errorf("err = %v, want ErrBadSettings", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	cands := []Candidate{cand("c", 0, 0, 1), cand("a", 0, 0, 1), cand("b", 0, 0, 1)}
+	tests := []struct {
+		name   string
+		cursor string
+		n      int
+		want   []string
+	}{
+		{"no cursor starts at first", "", 2, []string{"a", "b"}},
+		{"continues after cursor", "a", 2, []string{"b", "c"}},
+		{"wraps around", "b", 2, []string{"c", "a"}},
+		{"cursor at last wraps to first", "c", 1, []string{"a"}},
+		{"cursor past every user", "z", 2, []string{"a", "b"}},
+		{"cursor of a removed user", "bb", 2, []string{"c", "a"}},
+		{"n above candidates", "a", 5, []string{"b", "c", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := userIDs(rotate(cands, tt.cursor, tt.n))
+			if !equalStrings(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundRobinNextCursor(t *testing.T) {
+	cands := []Candidate{cand("a", 0, 0, 1), cand("b", 0, 0, 1), cand("c", 0, 0, 1)}
+	rr := RoundRobinSelector{}
+	cursor := ""
+	got := []string{}
+	for i := 0; i < 4; i++ {
+		picked := rr.Select(Selection{Candidates: cands, N: 2, Cursor: cursor})
+		got = append(got, userIDs(picked)...)
+		cursor = rr.NextCursor(picked)
+	}
+	want := []string{"a", "b", "c", "a", "b", "c", "a", "b"}
+	if !equalStrings(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+// TestRoundRobinCursorPersists expects the rotation to go on where it
+// stopped, also for a service started later over the same store.
+func TestRoundRobinCursorPersists(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	strategy := model.StrategyRoundRobin
+	members := []model.TeamMember{member("a", true), member("u1", true), member("u2", true), member("u3", true)}
+	createTeam(t, s, "backend", members, model.TeamSettingsUpdate{AssignmentStrategy: &strategy, MaxReviewers: intPtr(1)})
+
+	got := []string{}
+	for i := 0; i < 5; i++ {
+		if i == 3 {
+			s = NewService(s.Repo)
+		}
+		pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: fmt.Sprintf("pr-%d", i), PullRequestName: "x", AuthorID: "a"}, CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, pr.AssignedReviewers...)
+	}
+	if want := []string{"u1", "u2", "u3", "u1", "u2"}; !equalStrings(got, want) {
+		t.Errorf("reviewers %v, want %v", got, want)
+	}
+	cursor, err := s.Repo.GetRotationCursor(ctx, "backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor != "u2" {
+		t.Errorf("cursor = %q, want u2", cursor)
+	}
+}
+
+func TestPairingHistoryLowersChances(t *testing.T) {
+	checkShares(t, []shareCase{
+		{"random by pairing", RandomSelector{}, []Candidate{cand("a", 0, 0, 1), cand("b", 0, 2, 1)}, map[string]float64{"a": 0.75, "b": 0.25}},
+		{"weighted by pairing", WeightedSelector{}, []Candidate{cand("a", 1, 0, 1), cand("b", 0, 1, 1)}, map[string]float64{"a": 0.5, "b": 0.5}},
+	})
+
+	tests := []struct {
+		name  string
+		cands []Candidate
+		n     int
+		want  []string
+	}{
+		{"tie broken by recent reviews", []Candidate{cand("a", 1, 2, 1), cand("b", 1, 0, 1), cand("c", 1, 1, 1)}, 2, []string{"b", "c"}},
+		{"load before recent reviews", []Candidate{cand("a", 0, 5, 1), cand("b", 1, 0, 1)}, 1, []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(0); seed < 20; seed++ {
+				got := userIDs(LeastLoadedSelector{}.Select(Selection{Candidates: tt.cands, N: tt.n, Rand: rand.New(rand.NewSource(seed))}))
+				if !equalStrings(got, tt.want) {
+					t.Fatalf("seed %d: got %v, want %v", seed, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecentReviews(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("a", true), member("u1", true), member("u2", true), member("u3", true)},
+		model.TeamSettingsUpdate{MaxReviewers: intPtr(1), PairingHistory: intPtr(2)})
+	reviewers := []string{}
+	for i := 0; i < 3; i++ {
+		pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: fmt.Sprintf("pr-%d", i), PullRequestName: "x", AuthorID: "a"}, CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reviewers = append(reviewers, pr.AssignedReviewers...)
+	}
+
+	// Only the two latest pull requests of the author count.
+	recent, err := s.newPlan().recentReviews(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{}
+	for _, id := range reviewers[1:] {
+		want[id]++
+	}
+	if len(recent) != len(want) {
+		t.Errorf("recent = %v, want %v", recent, want)
+	}
+	for id, n := range want {
+		if recent[id] != n {
+			t.Errorf("recent[%s] = %d, want %d", id, recent[id], n)
+		}
+	}
+
+	if _, err := s.UpdateTeamSettings(ctx, "backend", model.TeamSettingsUpdate{PairingHistory: intPtr(0)}); err != nil {
+		t.Fatal(err)
+	}
+	if recent, err = s.newPlan().recentReviews(ctx, "a"); err != nil || len(recent) != 0 {
+		t.Errorf("pairing_history 0: recent = %v, err = %v", recent, err)
+	}
+	if _, err := s.UpdateTeamSettings(ctx, "backend", model.TeamSettingsUpdate{PairingHistory: intPtr(-1)}); !errors.Is(err, ErrBadSettings) {
+		t.Errorf("negative: err = %v, want ErrBadSettings", err)
+	}
+}
+
+func TestWeightRaisesChances(t *testing.T) {
+	checkShares(t, []shareCase{
+		{"random by weight", RandomSelector{}, []Candidate{cand("a", 0, 0, 3), cand("b", 0, 0, 1)}, map[string]float64{"a": 0.75, "b": 0.25}},
+		{"random default weight", RandomSelector{}, []Candidate{cand("a", 0, 0, 0), cand("b", 0, 0, 1)}, map[string]float64{"a": 0.5, "b": 0.5}},
+		{"weighted by load and weight", WeightedSelector{}, []Candidate{cand("a", 1, 0, 1), cand("b", 0, 0, 1), cand("c", 3, 0, 4)}, map[string]float64{"a": 0.2, "b": 0.4, "c": 0.4}},
+	})
+}
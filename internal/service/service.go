@@ -1,8 +1,11 @@
 package service
 
 import (
+	"context"
+	"database/sql"
 	"errors"
-	"math/rand"
+	"fmt"
+	"math"
 	"time"
 
 	"github.com/ilya2044/avito2025/internal/model"
@@ -11,120 +14,483 @@ import (
 
 var (
 	ErrTeamNotFound = errors.New("team or author not found")
+	ErrUserNotFound = errors.New("user not found")
 	ErrPRExists     = errors.New("pr exists")
 	ErrPRMerged     = errors.New("pr merged")
+	ErrPRClosed     = errors.New("pr closed")
+	ErrPRDraft      = errors.New("pr is a draft")
 	ErrNotAssigned  = errors.New("not assigned")
 	ErrNoCandidate  = errors.New("no candidate")
+	ErrBadSettings  = errors.New("invalid team settings")
+	ErrBadCount     = errors.New("invalid reviewers count")
+	ErrNotEnough    = errors.New("not enough active reviewers")
+	ErrBadDecision  = errors.New("invalid review decision")
+	ErrNotApproved  = errors.New("pr is not approved")
+	ErrBadPeriod    = errors.New("invalid unavailability period")
+	ErrBadCapacity  = errors.New("invalid max_open_reviews")
+	ErrBadProfile   = errors.New("invalid reviewer weight or tier")
+	ErrBadReviewer  = errors.New("invalid reviewer")
+	ErrAssigned     = errors.New("already assigned")
 )
 
 type Service struct {
-	Repo *storage.Repository
-	Rand *rand.Rand
+	Repo      storage.Store
+	Seeds     Seeder
+	Selectors map[string]ReviewerSelector
 }
 
-func NewService(r *storage.Repository) *Service {
-	return &Service{Repo: r, Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+func NewService(r storage.Store) *Service {
+	return &Service{
+		Repo:      r,
+		Seeds:     NewSeeder(time.Now().UnixNano()),
+		Selectors: DefaultSelectors(),
+	}
 }
 
-func (s *Service) CreateTeam(t model.Team) error {
-	return s.Repo.CreateTeam(t)
+// CreateTeam creates the team with the default settings overlaid with
+// the fields set in upd.
+func (s *Service) CreateTeam(ctx context.Context, t *model.Team, upd model.TeamSettingsUpdate) error {
+	settings := model.DefaultTeamSettings()
+	applySettings(&settings, upd)
+	if err := s.validateSettings(ctx, t.TeamName, settings); err != nil {
+		return err
+	}
+	t.Settings = &settings
+	for i := range t.Members {
+		m := &t.Members[i]
+		if m.Weight == 0 {
+			m.Weight = model.DefaultWeight
+		}
+		if err := checkProfile(m.Weight, m.Tier); err != nil {
+			return fmt.Errorf("%w (user %s)", err, m.UserID)
+		}
+	}
+	return s.Repo.CreateTeam(ctx, *t)
 }
 
-func (s *Service) GetTeam(name string) (model.Team, error) {
-	return s.Repo.GetTeam(name)
+func (s *Service) validateSettings(ctx context.Context, teamName string, ts model.TeamSettings) error {
+	if _, ok := s.Selectors[ts.AssignmentStrategy]; !ok {
+		return fmt.Errorf("%w: unknown assignment_strategy %q", ErrBadSettings, ts.AssignmentStrategy)
+	}
+	if ts.MinReviewers < 0 || ts.MaxReviewers < 1 || ts.MinReviewers > ts.MaxReviewers {
+		return fmt.Errorf("%w: need 0 <= min_reviewers <= max_reviewers and max_reviewers >= 1", ErrBadSettings)
+	}
+	if ts.RequiredApprovals < 0 {
+		return fmt.Errorf("%w: required_approvals must not be negative", ErrBadSettings)
+	}
+	if ts.PairingHistory < 0 {
+		return fmt.Errorf("%w: pairing_history must not be negative", ErrBadSettings)
+	}
+	if err := validateOwnershipRules(ts.OwnershipRules); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, fb := range ts.FallbackTeams {
+		if fb == teamName {
+			return fmt.Errorf("%w: team cannot be its own fallback", ErrBadSettings)
+		}
+		if seen[fb] {
+			return fmt.Errorf("%w: fallback team %s listed twice", ErrBadSettings, fb)
+		}
+		seen[fb] = true
+		if _, err := s.Repo.GetTeamSettings(ctx, fb); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("%w: fallback team %s not found", ErrBadSettings, fb)
+			}
+			return err
+		}
+	}
+	return nil
 }
 
-func (s *Service) SetUserIsActive(userID string, isActive bool) (model.User, error) {
-	return s.Repo.SetUserIsActive(userID, isActive)
+// UpdateTeamSettings applies the fields set in upd to the team settings.
+func (s *Service) UpdateTeamSettings(ctx context.Context, teamName string, upd model.TeamSettingsUpdate) (model.TeamSettings, error) {
+	ts, err := s.Repo.GetTeamSettings(ctx, teamName)
+	if err != nil {
+		return model.TeamSettings{}, err
+	}
+	applySettings(&ts, upd)
+	if err := s.validateSettings(ctx, teamName, ts); err != nil {
+		return model.TeamSettings{}, err
+	}
+	if err := s.Repo.UpdateTeamSettings(ctx, teamName, ts); err != nil {
+		return model.TeamSettings{}, err
+	}
+	return ts, nil
 }
 
-func (s *Service) CreatePullRequest(pr model.PullRequest) (model.PullRequest, error) {
-	_, err := s.Repo.GetPullRequest(pr.PullRequestID)
+func applySettings(ts *model.TeamSettings, upd model.TeamSettingsUpdate) {
+	if upd.AssignmentStrategy != nil {
+		ts.AssignmentStrategy = *upd.AssignmentStrategy
+	}
+	if upd.MinReviewers != nil {
+		ts.MinReviewers = *upd.MinReviewers
+	}
+	if upd.MaxReviewers != nil {
+		ts.MaxReviewers = *upd.MaxReviewers
+	}
+	if upd.RequiredApprovals != nil {
+		ts.RequiredApprovals = *upd.RequiredApprovals
+	}
+	if upd.PairingHistory != nil {
+		ts.PairingHistory = *upd.PairingHistory
+	}
+	if upd.FallbackTeams != nil {
+		ts.FallbackTeams = append([]string{}, *upd.FallbackTeams...)
+	}
+	if upd.OwnershipRules != nil {
+		ts.OwnershipRules = append([]model.OwnershipRule{}, *upd.OwnershipRules...)
+	}
+}
+
+func (s *Service) GetTeam(ctx context.Context, name string) (model.Team, error) {
+	return s.Repo.GetTeam(ctx, name)
+}
+
+func (s *Service) SetUserIsActive(ctx context.Context, userID string, isActive bool) (model.User, error) {
+	return s.Repo.SetUserIsActive(ctx, userID, isActive)
+}
+
+func (s *Service) GetUserCapacity(ctx context.Context, userID string) (model.UserCapacity, error) {
+	u, err := s.Repo.GetUser(ctx, userID)
+	if err != nil {
+		return model.UserCapacity{}, err
+	}
+	return s.userCapacity(ctx, u)
+}
+
+// SetUserCapacity limits how many OPEN pull requests the user reviews at
+// once; nil removes the limit. Reviews the user already has are kept
+// even if they exceed the new limit.
+func (s *Service) SetUserCapacity(ctx context.Context, userID string, limit *int) (model.UserCapacity, error) {
+	if limit != nil && *limit < 0 {
+		return model.UserCapacity{}, fmt.Errorf("%w: must not be negative", ErrBadCapacity)
+	}
+	u, err := s.Repo.SetUserCapacity(ctx, userID, limit)
+	if err != nil {
+		return model.UserCapacity{}, err
+	}
+	return s.userCapacity(ctx, u)
+}
+
+func (s *Service) userCapacity(ctx context.Context, u model.User) (model.UserCapacity, error) {
+	load, err := s.Repo.CountOpenReviews(ctx, []string{u.UserID})
+	if err != nil {
+		return model.UserCapacity{}, err
+	}
+	return model.UserCapacity{UserID: u.UserID, MaxOpenReviews: u.MaxOpenReviews, OpenReviews: load[u.UserID]}, nil
+}
+
+// SetUserProfile changes the fields given of the user's assignment
+// weight and tier. An empty tier removes it.
+func (s *Service) SetUserProfile(ctx context.Context, userID string, weight *float64, tier *string) (model.User, error) {
+	u, err := s.Repo.GetUser(ctx, userID)
+	if err != nil {
+		return model.User{}, err
+	}
+	if weight != nil {
+		u.Weight = *weight
+	}
+	if tier != nil {
+		u.Tier = *tier
+	}
+	if err := checkProfile(u.Weight, u.Tier); err != nil {
+		return model.User{}, err
+	}
+	return s.Repo.SetUserProfile(ctx, userID, u.Weight, u.Tier)
+}
+
+func checkProfile(weight float64, tier string) error {
+	if !(weight > 0) || math.IsInf(weight, 1) {
+		return fmt.Errorf("%w: weight must be positive", ErrBadProfile)
+	}
+	switch tier {
+	case "", model.TierJunior, model.TierSenior:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown tier %q", ErrBadProfile, tier)
+}
+
+// CreateOptions are the optional parts of a pull request creation request.
+type CreateOptions struct {
+	// ReviewersCount overrides the team's max_reviewers. It must lie
+	// within the team's min..max range. Drafts ignore it; pass it to
+	// MarkReady instead.
+	ReviewersCount *int
+	// Draft creates the pull request as DRAFT without reviewers.
+	Draft bool
+	// Reviewers are assigned by name before the rest are drawn and count
+	// towards the number of reviewers. A draft cannot have them.
+	Reviewers []string
+}
+
+func (s *Service) CreatePullRequest(ctx context.Context, pr model.PullRequest, opts CreateOptions) (model.PullRequest, error) {
+	_, err := s.Repo.GetPullRequest(ctx, pr.PullRequestID)
 	if err == nil {
 		return model.PullRequest{}, ErrPRExists
 	}
-	author, err := s.Repo.GetUser(pr.AuthorID)
+	author, err := s.Repo.GetUser(ctx, pr.AuthorID)
 	if err != nil {
 		return model.PullRequest{}, ErrTeamNotFound
 	}
-	exclude := []string{author.UserID}
-	candidates, err := s.Repo.GetActiveTeamMembers(author.TeamName, exclude)
+	pr.Files = normalizeFiles(pr.Files)
+	if opts.Draft && len(opts.Reviewers) > 0 {
+		return model.PullRequest{}, fmt.Errorf("%w: a draft has no reviewers", ErrBadReviewer)
+	}
+	named, err := s.requestedReviewers(ctx, author.UserID, opts.Reviewers)
 	if err != nil {
 		return model.PullRequest{}, err
 	}
-	assigned := pickN(candidates, s.Rand, 2)
-	uids := []string{}
-	for _, u := range assigned {
-		uids = append(uids, u.UserID)
+	if opts.Draft {
+		pr.Status = model.StatusDraft
+		if err := s.Repo.CreatePullRequest(ctx, pr, nil, nil, nil); err != nil {
+			return model.PullRequest{}, err
+		}
+		return s.Repo.GetPullRequest(ctx, pr.PullRequestID)
 	}
-	if err := s.Repo.CreatePullRequest(pr, uids); err != nil {
+	pr.Status = model.StatusOpen
+	err = s.retryRotation(func() error {
+		p := s.newPlan()
+		pools, n, err := s.planReviewers(ctx, p, author, pr.Files, nil, userIDs(named), opts.ReviewersCount)
+		if err != nil {
+			return err
+		}
+		draw := s.drawWithSenior
+		if hasSenior(named) {
+			draw = s.drawReviewers
+		}
+		drawn, err := draw(ctx, p, pools, n)
+		if err != nil {
+			return err
+		}
+		assigned := []storage.Assignment{}
+		for _, u := range named {
+			assigned = append(assigned, storage.Assignment{UserID: u.UserID})
+		}
+		assigned = append(assigned, drawn...)
+		dec := p.decision(pr.PullRequestID, model.ActionCreate, planMark{})
+		dec.Requested = userIDs(named)
+		return s.Repo.CreatePullRequest(ctx, pr, assigned, p.rotations(), []model.Decision{dec})
+	})
+	if err != nil {
 		return model.PullRequest{}, err
 	}
-	return s.Repo.GetPullRequest(pr.PullRequestID)
+	return s.Repo.GetPullRequest(ctx, pr.PullRequestID)
 }
 
-func pickN(cands []model.User, r *rand.Rand, n int) []model.User {
-	if len(cands) == 0 {
-		return []model.User{}
+// planReviewers returns the candidate pools for a pull request of author
+// changing files and how many reviewers to draw from them. Users in
+// exclude are left out for the reason given. The named reviewers are
+// assigned already and count towards the number of reviewers, so there
+// may not be more of them than requested or than max_reviewers.
+func (s *Service) planReviewers(ctx context.Context, p *assignPlan, author model.User, files []string, exclude map[string]string, named []string, requested *int) ([]candidatePool, int, error) {
+	ts, err := p.teamSettings(ctx, author.TeamName)
+	if err != nil {
+		return nil, 0, err
+	}
+	if requested != nil && len(named) > *requested {
+		return nil, 0, fmt.Errorf("%w: %d reviewers named, %d requested", ErrBadCount, len(named), *requested)
 	}
-	if len(cands) <= n {
-		return cands
+	if len(named) > ts.MaxReviewers {
+		return nil, 0, fmt.Errorf("%w: %d reviewers named, max_reviewers is %d", ErrBadCount, len(named), ts.MaxReviewers)
 	}
-	res := make([]model.User, n)
-	perm := r.Perm(len(cands))
-	for i := 0; i < n; i++ {
-		res[i] = cands[perm[i]]
+	skip := map[string]string{}
+	for id, reason := range exclude {
+		skip[id] = reason
 	}
-	return res
+	for _, id := range named {
+		skip[id] = model.ExcludedAssigned
+	}
+	pools, err := s.candidatePools(ctx, p, author.TeamName, author.UserID, files, skip)
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := reviewersCount(ts, requested, countCandidates(pools)+len(named))
+	if err != nil {
+		return nil, 0, err
+	}
+	return pools, max(n-len(named), 0), nil
 }
 
-func (s *Service) MergePullRequest(prID string) (model.PullRequest, error) {
-	return s.Repo.MergePullRequest(prID)
+// MergePullRequest merges the pull request once the author's team
+// required_approvals reviewers have approved it and nobody has requested
+// changes. force skips the check. Merging a merged pull request returns
+// it unchanged.
+func (s *Service) MergePullRequest(ctx context.Context, prID string, force bool) (model.PullRequest, error) {
+	var merged model.PullRequest
+	err := retryStatus(func() error {
+		pr, err := s.Repo.GetPullRequest(ctx, prID)
+		if err != nil {
+			return err
+		}
+		if pr.Status == model.StatusMerged {
+			merged = pr
+			return nil
+		}
+		if err := requireOpen(pr); err != nil {
+			return err
+		}
+		var check func([]model.Review) error
+		if !force {
+			author, err := s.Repo.GetUser(ctx, pr.AuthorID)
+			if err != nil {
+				return err
+			}
+			ts, err := s.Repo.GetTeamSettings(ctx, author.TeamName)
+			if err != nil {
+				return err
+			}
+			check = func(reviews []model.Review) error {
+				return checkApprovals(ts, reviews)
+			}
+		}
+		merged, err = s.Repo.MergePullRequest(ctx, prID, check)
+		return err
+	})
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+	return merged, nil
+}
+
+// checkApprovals fails with ErrNotApproved unless the team's
+// required_approvals reviewers approved and nobody requested changes.
+// The store runs it on the reviews as they are when merging.
+func checkApprovals(ts model.TeamSettings, reviews []model.Review) error {
+	approved := 0
+	for _, rv := range reviews {
+		switch rv.State {
+		case model.ReviewApproved:
+			approved++
+		case model.ReviewChangesRequested:
+			return fmt.Errorf("%w: %s requested changes", ErrNotApproved, rv.UserID)
+		}
+	}
+	if approved < ts.RequiredApprovals {
+		return fmt.Errorf("%w: %d of %d required approvals", ErrNotApproved, approved, ts.RequiredApprovals)
+	}
+	return nil
 }
 
-func (s *Service) ReassignReviewer(prID, oldUserID string) (model.PullRequest, string, error) {
-	pr, err := s.Repo.GetPullRequest(prID)
+func (s *Service) ReassignReviewer(ctx context.Context, prID, oldUserID string) (model.PullRequest, string, error) {
+	var new string
+	err := retryStatus(func() error {
+		pr, err := s.Repo.GetPullRequest(ctx, prID)
+		if err != nil {
+			return err
+		}
+		if err := requireOpen(pr); err != nil {
+			return err
+		}
+		return s.retryRotation(func() error {
+			p := s.newPlan()
+			repl, err := s.planReplacement(ctx, p, pr, oldUserID, nil)
+			if err != nil {
+				return err
+			}
+			new = repl.UserID
+			dec := p.decision(prID, model.ActionReassign, planMark{})
+			dec.ReplacedUserID = oldUserID
+			return s.Repo.ReplaceReviewer(ctx, prID, oldUserID, repl, p.rotations(), []model.Decision{dec})
+		})
+	})
 	if err != nil {
 		return model.PullRequest{}, "", err
 	}
-	if pr.Status == "MERGED" {
-		return model.PullRequest{}, "", ErrPRMerged
-	}
-	assignedMap := map[string]bool{}
+	updatedPR, err := s.Repo.GetPullRequest(ctx, prID)
+	return updatedPR, new, err
+}
+
+// planReplacement picks who takes over oldUserID's review of pr. The
+// pools are built as for a new pull request: the author's team first,
+// then its fallback teams, and a replacement from a fallback team is
+// marked as such. Candidates are not the author, not assigned already,
+// have not declined pr and are not in exclude, the users being
+// deactivated.
+func (s *Service) planReplacement(ctx context.Context, p *assignPlan, pr model.PullRequest, oldUserID string, exclude []string) (storage.Assignment, error) {
+	assigned := false
 	for _, a := range pr.AssignedReviewers {
-		assignedMap[a] = true
+		if a == oldUserID {
+			assigned = true
+		}
 	}
-	if !assignedMap[oldUserID] {
-		return model.PullRequest{}, "", ErrNotAssigned
+	if !assigned {
+		return storage.Assignment{}, ErrNotAssigned
 	}
-	oldUser, err := s.Repo.GetUser(oldUserID)
+	author, err := p.user(ctx, pr.AuthorID)
 	if err != nil {
-		return model.PullRequest{}, "", err
+		return storage.Assignment{}, err
 	}
-	exclude := append(pr.AssignedReviewers, pr.AuthorID)
-	cands, err := s.Repo.GetActiveTeamMembers(oldUser.TeamName, exclude)
+	skip := map[string]string{}
+	for _, id := range pr.AssignedReviewers {
+		skip[id] = model.ExcludedAssigned
+	}
+	for id, reason := range declined(pr) {
+		skip[id] = reason
+	}
+	for _, id := range exclude {
+		skip[id] = model.ExcludedDeactivated
+	}
+	if skip[oldUserID] == model.ExcludedAssigned {
+		skip[oldUserID] = model.ExcludedReplaced
+	}
+	pools, err := s.candidatePools(ctx, p, author.TeamName, author.UserID, pr.Files, skip)
 	if err != nil {
-		return model.PullRequest{}, "", err
+		return storage.Assignment{}, err
 	}
-	if len(cands) == 0 {
-		return model.PullRequest{}, "", ErrNoCandidate
+	if countCandidates(pools) == 0 {
+		return storage.Assignment{}, ErrNoCandidate
 	}
-	new := cands[s.Rand.Intn(len(cands))].UserID
-	if err := s.Repo.ReplaceReviewer(prID, oldUserID, new); err != nil {
-		return model.PullRequest{}, "", err
+	picked, err := s.drawReviewers(ctx, p, pools, 1)
+	if err != nil {
+		return storage.Assignment{}, err
 	}
-	updatedPR, err := s.Repo.GetPullRequest(prID)
-	return updatedPR, new, err
+	return picked[0], nil
 }
 
-func (s *Service) GetPRsByReviewer(userID string) ([]model.PullRequestShort, error) {
-	return s.Repo.GetPRsByReviewer(userID)
+// ReviewPullRequest records the decision of an assigned reviewer. A later
+// decision replaces the earlier one, except that a comment does not undo
+// an approval or a request for changes.
+func (s *Service) ReviewPullRequest(ctx context.Context, prID, userID, decision, comment string) (model.PullRequest, error) {
+	switch decision {
+	case model.ReviewApproved, model.ReviewChangesRequested, model.ReviewCommented:
+	default:
+		return model.PullRequest{}, fmt.Errorf("%w: %q", ErrBadDecision, decision)
+	}
+	err := retryStatus(func() error {
+		pr, err := s.Repo.GetPullRequest(ctx, prID)
+		if err != nil {
+			return err
+		}
+		if err := requireOpen(pr); err != nil {
+			return err
+		}
+		err = s.Repo.SetReviewState(ctx, prID, userID, decision, comment)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotAssigned
+		}
+		return err
+	})
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+	return s.Repo.GetPullRequest(ctx, prID)
+}
+
+func (s *Service) GetPRsByReviewer(ctx context.Context, userID string) ([]model.PullRequestShort, error) {
+	return s.Repo.GetPRsByReviewer(ctx, userID)
 }
 
-func (s *Service) AddUserToTeam(teamName string, u model.User) (model.Team, error) {
-	return s.Repo.AddUserToTeam(teamName, u)
+func (s *Service) AddUserToTeam(ctx context.Context, teamName string, u model.User) (model.Team, error) {
+	if u.Weight == 0 {
+		u.Weight = model.DefaultWeight
+	}
+	if err := checkProfile(u.Weight, u.Tier); err != nil {
+		return model.Team{}, err
+	}
+	return s.Repo.AddUserToTeam(ctx, teamName, u)
 }
 
-func (s *Service) RemoveUserFromTeam(teamName, userID string) (model.Team, error) {
-	return s.Repo.RemoveUserFromTeam(teamName, userID)
+func (s *Service) RemoveUserFromTeam(ctx context.Context, teamName, userID string) (model.Team, error) {
+	return s.Repo.RemoveUserFromTeam(ctx, teamName, userID)
 }
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/model"
+	"github.com/ilya2044/avito2025/internal/storage"
+)
+
+// newTestService returns a service over an empty MemoryStore with a
+// fixed seed sequence.
+func newTestService() *Service {
+	s := NewService(storage.NewMemoryStore())
+	s.Seeds = NewSeeder(1)
+	return s
+}
+
+func createTeam(t *testing.T, s *Service, name string, members []model.TeamMember, upd model.TeamSettingsUpdate) {
+	t.Helper()
+	team := model.Team{TeamName: name, Members: members}
+	if err := s.CreateTeam(context.Background(), &team, upd); err != nil {
+		t.Fatalf("create team %s: %v", name, err)
+	}
+}
+
+func member(id string, active bool) model.TeamMember {
+	return model.TeamMember{UserID: id, Username: id, IsActive: active}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fallbackIDs returns the sorted users of pr.FallbackReviewers that came
+// from team.
+func fallbackIDs(pr model.PullRequest, team string) []string {
+	ids := []string{}
+	for _, fr := range pr.FallbackReviewers {
+		if fr.TeamName == team {
+			ids = append(ids, fr.UserID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func sortedReviewers(pr model.PullRequest) []string {
+	ids := append([]string{}, pr.AssignedReviewers...)
+	sort.Strings(ids)
+	return ids
+}
+
+func TestReassignThroughFallback(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "fb", []model.TeamMember{member("f1", true), member("f2", true), member("f3", true), member("f4", true)}, model.TeamSettingsUpdate{})
+	createTeam(t, s, "core", []model.TeamMember{member("a", true), member("c1", false)}, model.TeamSettingsUpdate{FallbackTeams: &[]string{"fb"}})
+
+	pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "a"}, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.AssignedReviewers) != 2 || !equalStrings(fallbackIDs(pr, "fb"), sortedReviewers(pr)) {
+		t.Fatalf("reviewers %v, fallback %+v", pr.AssignedReviewers, pr.FallbackReviewers)
+	}
+
+	// The replaced reviewer came from fb, the replacement does too and
+	// is reported as a fallback reviewer.
+	pr, replacedBy, err := s.ReassignReviewer(ctx, "pr-1", pr.AssignedReviewers[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(fallbackIDs(pr, "fb"), sortedReviewers(pr)) {
+		t.Fatalf("replaced by %s: reviewers %v, fallback %+v", replacedBy, pr.AssignedReviewers, pr.FallbackReviewers)
+	}
+
+	// Once the author's own team has someone eligible, they are asked
+	// first, even though the reviewer being replaced is from fb.
+	if _, err := s.Repo.SetUserIsActive(ctx, "c1", true); err != nil {
+		t.Fatal(err)
+	}
+	old := pr.AssignedReviewers[0]
+	pr, replacedBy, err = s.ReassignReviewer(ctx, "pr-1", old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacedBy != "c1" {
+		t.Fatalf("%s replaced by %s, want c1", old, replacedBy)
+	}
+	if got := fallbackIDs(pr, "fb"); len(got) != 1 || got[0] == "c1" || got[0] == old {
+		t.Fatalf("reviewers %v, fallback %+v", pr.AssignedReviewers, pr.FallbackReviewers)
+	}
+	if len(pr.FallbackReviewers) != 1 {
+		t.Fatalf("fallback %+v, want only the fb reviewer", pr.FallbackReviewers)
+	}
+
+	// Without c1 the author's team has nobody left, so replacing c1
+	// goes back to fb.
+	if _, err := s.Repo.SetUserIsActive(ctx, "c1", false); err != nil {
+		t.Fatal(err)
+	}
+	pr, replacedBy, err = s.ReassignReviewer(ctx, "pr-1", "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.AssignedReviewers) != 2 || !equalStrings(fallbackIDs(pr, "fb"), sortedReviewers(pr)) {
+		t.Fatalf("replaced by %s: reviewers %v, fallback %+v", replacedBy, pr.AssignedReviewers, pr.FallbackReviewers)
+	}
+}
+
+// reviewState returns the review state of userID on pr.
+func reviewState(pr model.PullRequest, userID string) string {
+	for _, rv := range pr.Reviews {
+		if rv.UserID == userID {
+			return rv.State
+		}
+	}
+	return ""
+}
+
+func TestReviewPullRequest(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("a", true), member("u1", true), member("u2", true), member("u3", true)}, model.TeamSettingsUpdate{})
+	pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "a"}, CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1 := pr.AssignedReviewers[0]
+	outsider := "u1"
+	for _, id := range []string{"u1", "u2", "u3"} {
+		if !containsUser(pr.AssignedReviewers, id) {
+			outsider = id
+		}
+	}
+	if got := reviewState(pr, r1); got != model.ReviewPending {
+		t.Fatalf("new review state = %q, want PENDING", got)
+	}
+
+	steps := []struct {
+		decision string
+		want     string
+	}{
+		{model.ReviewCommented, model.ReviewCommented},
+		{model.ReviewChangesRequested, model.ReviewChangesRequested},
+		// A comment keeps an earlier request for changes or approval.
+		{model.ReviewCommented, model.ReviewChangesRequested},
+		{model.ReviewApproved, model.ReviewApproved},
+		{model.ReviewCommented, model.ReviewApproved},
+	}
+	for i, st := range steps {
+		pr, err = s.ReviewPullRequest(ctx, "pr-1", r1, st.decision, fmt.Sprintf("comment %d", i))
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got := reviewState(pr, r1); got != st.want {
+			t.Errorf("step %d: state after %s = %q, want %q", i, st.decision, got, st.want)
+		}
+	}
+
+	if _, err := s.ReviewPullRequest(ctx, "pr-1", r1, "LGTM", ""); !errors.Is(err, ErrBadDecision) {
+		t.Errorf("unknown decision: err = %v, want ErrBadDecision", err)
+	}
+	if _, err := s.ReviewPullRequest(ctx, "pr-1", outsider, model.ReviewApproved, ""); !errors.Is(err, ErrNotAssigned) {
+		t.Errorf("not assigned: err = %v, want ErrNotAssigned", err)
+	}
+	if _, err := s.MergePullRequest(ctx, "pr-1", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReviewPullRequest(ctx, "pr-1", r1, model.ReviewApproved, ""); !errors.Is(err, ErrPRMerged) {
+		t.Errorf("merged: err = %v, want ErrPRMerged", err)
+	}
+}
+
+func TestMergeRequiresApprovals(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("a", true), member("u1", true), member("u2", true)},
+		model.TeamSettingsUpdate{RequiredApprovals: intPtr(2)})
+	for _, id := range []string{"pr-1", "pr-2"} {
+		if _, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: id, PullRequestName: "x", AuthorID: "a"}, CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.MergePullRequest(ctx, "pr-1", false); !errors.Is(err, ErrNotApproved) {
+		t.Fatalf("no approvals: err = %v, want ErrNotApproved", err)
+	}
+	if _, err := s.ReviewPullRequest(ctx, "pr-1", "u1", model.ReviewApproved, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReviewPullRequest(ctx, "pr-1", "u2", model.ReviewChangesRequested, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MergePullRequest(ctx, "pr-1", false); !errors.Is(err, ErrNotApproved) {
+		t.Fatalf("changes requested: err = %v, want ErrNotApproved", err)
+	}
+	if _, err := s.ReviewPullRequest(ctx, "pr-1", "u2", model.ReviewApproved, ""); err != nil {
+		t.Fatal(err)
+	}
+	merged, err := s.MergePullRequest(ctx, "pr-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Status != model.StatusMerged || merged.MergedAt == nil {
+		t.Fatalf("status %s, mergedAt %v", merged.Status, merged.MergedAt)
+	}
+
+	// Merging again returns the merged PR unchanged.
+	again, err := s.MergePullRequest(ctx, "pr-1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Status != model.StatusMerged || !again.MergedAt.Equal(*merged.MergedAt) {
+		t.Errorf("second merge: status %s, mergedAt %v, want %v", again.Status, again.MergedAt, merged.MergedAt)
+	}
+
+	// force skips the approval check.
+	if _, err := s.MergePullRequest(ctx, "pr-2", true); err != nil {
+		t.Errorf("forced merge: %v", err)
+	}
+
+	if _, err := s.UpdateTeamSettings(ctx, "backend", model.TeamSettingsUpdate{RequiredApprovals: intPtr(-1)}); !errors.Is(err, ErrBadSettings) {
+		t.Errorf("negative required_approvals: err = %v, want ErrBadSettings", err)
+	}
+}
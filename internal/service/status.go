@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ilya2044/avito2025/internal/model"
+	"github.com/ilya2044/avito2025/internal/storage"
+)
+
+// requireOpen returns the error for acting on a pull request that is not
+// OPEN.
+func requireOpen(pr model.PullRequest) error {
+	switch pr.Status {
+	case model.StatusMerged:
+		return ErrPRMerged
+	case model.StatusClosed:
+		return ErrPRClosed
+	case model.StatusDraft:
+		return ErrPRDraft
+	}
+	return nil
+}
+
+// MarkReady takes a draft out of DRAFT and assigns its reviewers.
+// requested works like CreateOptions.ReviewersCount. An OPEN pull
+// request is returned unchanged.
+func (s *Service) MarkReady(ctx context.Context, prID string, requested *int) (model.PullRequest, error) {
+	var pr model.PullRequest
+	err := retryStatus(func() error {
+		var err error
+		pr, err = s.Repo.GetPullRequest(ctx, prID)
+		if err != nil {
+			return err
+		}
+		switch pr.Status {
+		case model.StatusOpen:
+			return nil
+		case model.StatusDraft:
+			return s.openPullRequest(ctx, pr, model.ActionReady, requested)
+		}
+		return requireOpen(pr)
+	})
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+	return s.Repo.GetPullRequest(ctx, prID)
+}
+
+// ClosePullRequest abandons an OPEN or DRAFT pull request. Its reviewers
+// stay recorded but it no longer counts as their open review. Closing a
+// closed pull request returns it unchanged.
+func (s *Service) ClosePullRequest(ctx context.Context, prID string) (model.PullRequest, error) {
+	err := retryStatus(func() error {
+		pr, err := s.Repo.GetPullRequest(ctx, prID)
+		if err != nil {
+			return err
+		}
+		switch pr.Status {
+		case model.StatusClosed:
+			return nil
+		case model.StatusMerged:
+			return ErrPRMerged
+		}
+		return s.Repo.SetPullRequestStatus(ctx, prID, pr.Status, model.StatusClosed, nil, nil, nil, nil, nil)
+	})
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+	return s.Repo.GetPullRequest(ctx, prID)
+}
+
+// ReopenPullRequest brings a CLOSED pull request back to OPEN. It keeps
+// its active reviewers; one closed as a draft gets them assigned now.
+// OPEN and DRAFT pull requests are returned unchanged.
+func (s *Service) ReopenPullRequest(ctx context.Context, prID string) (model.PullRequest, error) {
+	err := retryStatus(func() error {
+		pr, err := s.Repo.GetPullRequest(ctx, prID)
+		if err != nil {
+			return err
+		}
+		switch pr.Status {
+		case model.StatusOpen, model.StatusDraft:
+			return nil
+		case model.StatusMerged:
+			return ErrPRMerged
+		}
+		if len(pr.AssignedReviewers) == 0 {
+			return s.openPullRequest(ctx, pr, model.ActionReopen, nil)
+		}
+		return s.reopenWithReviewers(ctx, pr)
+	})
+	if err != nil {
+		return model.PullRequest{}, err
+	}
+	return s.Repo.GetPullRequest(ctx, prID)
+}
+
+// reopenWithReviewers moves pr back to OPEN. Reviewers deactivated while
+// it was closed are replaced as ReassignReviewer would, or dropped when
+// nobody can take over.
+func (s *Service) reopenWithReviewers(ctx context.Context, pr model.PullRequest) error {
+	return s.retryRotation(func() error {
+		p := s.newPlan()
+		if err := p.loadUsers(ctx, pr.AssignedReviewers); err != nil {
+			return err
+		}
+		pr := pr
+		var repls []storage.Replacement
+		removed := []string{}
+		decs := []model.Decision{}
+		for _, uid := range append([]string{}, pr.AssignedReviewers...) {
+			u, err := p.user(ctx, uid)
+			if err != nil {
+				return err
+			}
+			if u.IsActive {
+				continue
+			}
+			mark := p.mark()
+			repl, err := s.planReplacement(ctx, p, pr, uid, nil)
+			if errors.Is(err, ErrNoCandidate) {
+				removed = append(removed, uid)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			// The next inactive reviewer must not get the same
+			// replacement.
+			pr.AssignedReviewers = append(pr.AssignedReviewers, repl.UserID)
+			repls = append(repls, storage.Replacement{PullRequestID: pr.PullRequestID, OldUserID: uid, New: repl})
+			dec := p.decision(pr.PullRequestID, model.ActionReopen, mark)
+			dec.ReplacedUserID = uid
+			decs = append(decs, dec)
+		}
+		return s.Repo.SetPullRequestStatus(ctx, pr.PullRequestID, pr.Status, model.StatusOpen, nil, repls, removed, p.rotations(), decs)
+	})
+}
+
+// openPullRequest moves pr to OPEN and assigns its reviewers in the same
+// step, recording the decision under action.
+func (s *Service) openPullRequest(ctx context.Context, pr model.PullRequest, action string, requested *int) error {
+	author, err := s.Repo.GetUser(ctx, pr.AuthorID)
+	if err != nil {
+		return err
+	}
+	return s.retryRotation(func() error {
+		p := s.newPlan()
+		pools, n, err := s.planReviewers(ctx, p, author, pr.Files, declined(pr), nil, requested)
+		if err != nil {
+			return err
+		}
+		assigned, err := s.drawWithSenior(ctx, p, pools, n)
+		if err != nil {
+			return err
+		}
+		decs := []model.Decision{p.decision(pr.PullRequestID, action, planMark{})}
+		return s.Repo.SetPullRequestStatus(ctx, pr.PullRequestID, pr.Status, model.StatusOpen, assigned, nil, nil, p.rotations(), decs)
+	})
+}
+
+// statusAttempts bounds how often a status change is retried when the
+// pull request changed between reading and writing it.
+const statusAttempts = 3
+
+// retryStatus reruns fn, which must read the pull request afresh, when
+// it failed with storage.ErrStatusConflict.
+func retryStatus(fn func() error) error {
+	var err error
+	for i := 0; i < statusAttempts; i++ {
+		err = fn()
+		if !errors.Is(err, storage.ErrStatusConflict) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+// reviewingIDs returns the pull requests GetPRsByReviewer lists for userID.
+func reviewingIDs(t *testing.T, s *Service, userID string) []string {
+	t.Helper()
+	prs, err := s.GetPRsByReviewer(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, pr := range prs {
+		ids = append(ids, pr.PullRequestID)
+	}
+	return ids
+}
+
+func TestDraftLifecycle(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("a", true), member("u1", true), member("u2", true)}, model.TeamSettingsUpdate{})
+
+	pr, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "a"}, CreateOptions{Draft: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Status != model.StatusDraft || len(pr.AssignedReviewers) != 0 {
+		t.Fatalf("draft: status %s, reviewers %v", pr.Status, pr.AssignedReviewers)
+	}
+	if _, err := s.MergePullRequest(ctx, "pr-1", true); !errors.Is(err, ErrPRDraft) {
+		t.Errorf("merge draft: err = %v, want ErrPRDraft", err)
+	}
+	if _, _, err := s.ReassignReviewer(ctx, "pr-1", "u1"); !errors.Is(err, ErrPRDraft) {
+		t.Errorf("reassign on draft: err = %v, want ErrPRDraft", err)
+	}
+
+	pr, err = s.MarkReady(ctx, "pr-1", intPtr(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Status != model.StatusOpen || len(pr.AssignedReviewers) != 1 {
+		t.Fatalf("ready: status %s, reviewers %v", pr.Status, pr.AssignedReviewers)
+	}
+	again, err := s.MarkReady(ctx, "pr-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(again.AssignedReviewers, pr.AssignedReviewers) {
+		t.Errorf("second ready: reviewers %v, want %v", again.AssignedReviewers, pr.AssignedReviewers)
+	}
+}
+
+func TestCloseAndReopen(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("a", true), member("u1", true), member("u2", true)}, model.TeamSettingsUpdate{})
+	if _, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "a"}, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-2", PullRequestName: "x", AuthorID: "a"}, CreateOptions{Draft: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := s.ClosePullRequest(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Status != model.StatusClosed || !equalStrings(sortedReviewers(pr), []string{"u1", "u2"}) {
+		t.Fatalf("closed: status %s, reviewers %v", pr.Status, pr.AssignedReviewers)
+	}
+	if got := reviewingIDs(t, s, "u1"); len(got) != 0 {
+		t.Errorf("u1 reviews %v, a closed PR must not be listed", got)
+	}
+	if _, err := s.ReviewPullRequest(ctx, "pr-1", "u1", model.ReviewApproved, ""); !errors.Is(err, ErrPRClosed) {
+		t.Errorf("review closed: err = %v, want ErrPRClosed", err)
+	}
+	if _, err := s.ClosePullRequest(ctx, "pr-1"); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+
+	pr, err = s.ReopenPullRequest(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Status != model.StatusOpen || !equalStrings(sortedReviewers(pr), []string{"u1", "u2"}) {
+		t.Fatalf("reopened: status %s, reviewers %v", pr.Status, pr.AssignedReviewers)
+	}
+	if got := reviewingIDs(t, s, "u1"); !equalStrings(got, []string{"pr-1"}) {
+		t.Errorf("u1 reviews %v, want [pr-1]", got)
+	}
+
+	// A draft closed and reopened gets its reviewers on reopening.
+	if _, err := s.ClosePullRequest(ctx, "pr-2"); err != nil {
+		t.Fatal(err)
+	}
+	pr, err = s.ReopenPullRequest(ctx, "pr-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Status != model.StatusOpen || len(pr.AssignedReviewers) != 2 {
+		t.Errorf("reopened draft: status %s, reviewers %v", pr.Status, pr.AssignedReviewers)
+	}
+
+	if _, err := s.MergePullRequest(ctx, "pr-1", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ClosePullRequest(ctx, "pr-1"); !errors.Is(err, ErrPRMerged) {
+		t.Errorf("close merged: err = %v, want ErrPRMerged", err)
+	}
+	if _, err := s.ReopenPullRequest(ctx, "pr-1"); !errors.Is(err, ErrPRMerged) {
+		t.Errorf("reopen merged: err = %v, want ErrPRMerged", err)
+	}
+}
+
+func TestReopenReplacesInactiveReviewers(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService()
+	createTeam(t, s, "backend", []model.TeamMember{member("a", true), member("u1", true), member("u2", true), member("u3", false)}, model.TeamSettingsUpdate{})
+	if _, err := s.CreatePullRequest(ctx, model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "a"}, CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ClosePullRequest(ctx, "pr-1"); err != nil {
+		t.Fatal(err)
+	}
+	// u1 leaves while the pull request is closed, u3 can take over.
+	if _, err := s.Repo.SetUserIsActive(ctx, "u1", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Repo.SetUserIsActive(ctx, "u3", true); err != nil {
+		t.Fatal(err)
+	}
+	pr, err := s.ReopenPullRequest(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Status != model.StatusOpen || !equalStrings(sortedReviewers(pr), []string{"u2", "u3"}) {
+		t.Fatalf("reopened: status %s, reviewers %v, want u1 replaced by u3", pr.Status, pr.AssignedReviewers)
+	}
+	decs, err := s.ListDecisions(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := decs[len(decs)-1]; last.Action != model.ActionReopen || last.ReplacedUserID != "u1" {
+		t.Errorf("last decision = %+v, want a reopen replacing u1", last)
+	}
+
+	// Nobody is left to take over from u2, so u2 is dropped.
+	if _, err := s.ClosePullRequest(ctx, "pr-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Repo.SetUserIsActive(ctx, "u2", false); err != nil {
+		t.Fatal(err)
+	}
+	pr, err = s.ReopenPullRequest(ctx, "pr-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Status != model.StatusOpen || !equalStrings(pr.AssignedReviewers, []string{"u3"}) {
+		t.Errorf("reopened: status %s, reviewers %v, want only u3", pr.Status, pr.AssignedReviewers)
+	}
+}
@@ -0,0 +1,853 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+// MemoryStore keeps everything in process memory. It follows the same
+// constraints as the Postgres schema and every method is atomic.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	teams     map[string]model.TeamSettings
+	users     map[string]model.User
+	userOrder []string
+	prs       map[string]model.PullRequest
+	reviewers map[string]map[string]*memReviewer
+	cursors   map[string]string
+	away      []model.Unavailability
+	lastAway  int64
+	decisions map[string][]model.Decision
+	lastDec   int64
+	declines  map[string]map[string]model.Decline
+}
+
+// memReviewer is a pr_reviewers row.
+type memReviewer struct {
+	fallbackTeam string
+	state        string
+	comment      string
+	assignedAt   time.Time
+	decidedAt    *time.Time
+}
+
+func newMemReviewer(a Assignment) *memReviewer {
+	return &memReviewer{fallbackTeam: a.FallbackTeam, state: model.ReviewPending, assignedAt: time.Now().UTC()}
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		teams:     map[string]model.TeamSettings{},
+		users:     map[string]model.User{},
+		prs:       map[string]model.PullRequest{},
+		reviewers: map[string]map[string]*memReviewer{},
+		cursors:   map[string]string{},
+		decisions: map[string][]model.Decision{},
+		declines:  map[string]map[string]model.Decline{},
+	}
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+func (m *MemoryStore) CreateTeam(ctx context.Context, team model.Team) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.teams[team.TeamName]; ok {
+		return fmt.Errorf("team %s already exists", team.TeamName)
+	}
+	seen := map[string]bool{}
+	for _, mem := range team.Members {
+		if _, ok := m.users[mem.UserID]; ok {
+			return fmt.Errorf("user %s already exists", mem.UserID)
+		}
+		if seen[mem.UserID] {
+			return fmt.Errorf("cannot add user %s: duplicate user_id", mem.UserID)
+		}
+		seen[mem.UserID] = true
+	}
+
+	settings := model.DefaultTeamSettings()
+	if team.Settings != nil {
+		settings = *team.Settings
+	}
+	if err := m.checkFallbacks(settings.FallbackTeams); err != nil {
+		return err
+	}
+	m.teams[team.TeamName] = copySettings(settings)
+	for _, mem := range team.Members {
+		m.insertUser(model.User{
+			UserID:   mem.UserID,
+			Username: mem.Username,
+			TeamName: team.TeamName,
+			IsActive: mem.IsActive,
+			Weight:   mem.Weight,
+			Tier:     mem.Tier,
+		})
+	}
+	return nil
+}
+
+func (m *MemoryStore) insertUser(u model.User) {
+	m.users[u.UserID] = u
+	m.userOrder = append(m.userOrder, u.UserID)
+}
+
+func (m *MemoryStore) GetTeam(ctx context.Context, teamName string) (model.Team, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.team(teamName), nil
+}
+
+func (m *MemoryStore) team(teamName string) model.Team {
+	t := model.Team{TeamName: teamName, Members: []model.TeamMember{}}
+	if settings, ok := m.teams[teamName]; ok {
+		t.Settings = &settings
+	}
+	for _, id := range m.userOrder {
+		u := m.users[id]
+		if u.TeamName != teamName {
+			continue
+		}
+		t.Members = append(t.Members, model.TeamMember{UserID: u.UserID, Username: u.Username, IsActive: u.IsActive, Weight: u.Weight, Tier: u.Tier})
+	}
+	return t
+}
+
+func (m *MemoryStore) GetTeamSettings(ctx context.Context, teamName string) (model.TeamSettings, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.teams[teamName]
+	if !ok {
+		return model.TeamSettings{}, sql.ErrNoRows
+	}
+	return copySettings(s), nil
+}
+
+func (m *MemoryStore) UpdateTeamSettings(ctx context.Context, teamName string, s model.TeamSettings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.teams[teamName]; !ok {
+		return sql.ErrNoRows
+	}
+	if err := m.checkFallbacks(s.FallbackTeams); err != nil {
+		return err
+	}
+	m.teams[teamName] = copySettings(s)
+	return nil
+}
+
+func (m *MemoryStore) checkFallbacks(fallbacks []string) error {
+	seen := map[string]bool{}
+	for _, fb := range fallbacks {
+		if _, ok := m.teams[fb]; !ok {
+			return fmt.Errorf("cannot add fallback team %s: team not found", fb)
+		}
+		if seen[fb] {
+			return fmt.Errorf("cannot add fallback team %s: listed twice", fb)
+		}
+		seen[fb] = true
+	}
+	return nil
+}
+
+func copySettings(s model.TeamSettings) model.TeamSettings {
+	s.FallbackTeams = append([]string{}, s.FallbackTeams...)
+	rules := make([]model.OwnershipRule, len(s.OwnershipRules))
+	for i, rule := range s.OwnershipRules {
+		rules[i] = model.OwnershipRule{Pattern: rule.Pattern, Owners: append([]string{}, rule.Owners...)}
+	}
+	s.OwnershipRules = rules
+	return s
+}
+
+// copyStrings copies s, keeping nil as nil.
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
+func (m *MemoryStore) SetUserIsActive(ctx context.Context, userID string, isActive bool) (model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return model.User{}, sql.ErrNoRows
+	}
+	u.IsActive = isActive
+	m.users[userID] = u
+	return u, nil
+}
+
+func (m *MemoryStore) DeactivateUsers(ctx context.Context, userIDs []string, repls []Replacement, rots []Rotation, decs []model.Decision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range userIDs {
+		if _, ok := m.users[id]; !ok {
+			return sql.ErrNoRows
+		}
+	}
+	if err := m.checkReplacements(repls); err != nil {
+		return err
+	}
+	if err := m.checkRotations(rots); err != nil {
+		return err
+	}
+	for _, id := range userIDs {
+		u := m.users[id]
+		u.IsActive = false
+		m.users[id] = u
+	}
+	m.applyReplacements(repls)
+	m.advanceRotations(rots)
+	m.recordDecisions(decs)
+	return nil
+}
+
+// checkReplacements fails as replaceReviewers does in the SQL store.
+func (m *MemoryStore) checkReplacements(repls []Replacement) error {
+	taken := map[string]map[string]bool{}
+	for _, rp := range repls {
+		if m.prs[rp.PullRequestID].Status != model.StatusOpen || !m.assigned(rp.PullRequestID, rp.OldUserID) {
+			return ErrStatusConflict
+		}
+		if _, ok := m.users[rp.New.UserID]; !ok {
+			return fmt.Errorf("reviewer %s not found", rp.New.UserID)
+		}
+		if taken[rp.PullRequestID] == nil {
+			taken[rp.PullRequestID] = map[string]bool{}
+		}
+		if m.assigned(rp.PullRequestID, rp.New.UserID) || taken[rp.PullRequestID][rp.New.UserID] {
+			return fmt.Errorf("reviewer %s already assigned", rp.New.UserID)
+		}
+		taken[rp.PullRequestID][rp.New.UserID] = true
+	}
+	return nil
+}
+
+func (m *MemoryStore) applyReplacements(repls []Replacement) {
+	for _, rp := range repls {
+		delete(m.reviewers[rp.PullRequestID], rp.OldUserID)
+		m.reviewers[rp.PullRequestID][rp.New.UserID] = newMemReviewer(rp.New)
+	}
+}
+
+func (m *MemoryStore) GetUsers(ctx context.Context, userIDs []string) ([]model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := []model.User{}
+	for _, id := range userIDs {
+		if u, ok := m.users[id]; ok {
+			res = append(res, u)
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) SetUserCapacity(ctx context.Context, userID string, limit *int) (model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return model.User{}, sql.ErrNoRows
+	}
+	u.MaxOpenReviews = copyInt(limit)
+	m.users[userID] = u
+	return u, nil
+}
+
+func (m *MemoryStore) SetUserProfile(ctx context.Context, userID string, weight float64, tier string) (model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return model.User{}, sql.ErrNoRows
+	}
+	u.Weight = weight
+	u.Tier = tier
+	m.users[userID] = u
+	return u, nil
+}
+
+// copyInt keeps stored users from sharing an int with the caller.
+func copyInt(n *int) *int {
+	if n == nil {
+		return nil
+	}
+	v := *n
+	return &v
+}
+
+func (m *MemoryStore) GetUser(ctx context.Context, userID string) (model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[userID]
+	if !ok {
+		return model.User{}, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (m *MemoryStore) CreatePullRequest(ctx context.Context, pr model.PullRequest, assigned []Assignment, rots []Rotation, decs []model.Decision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.prs[pr.PullRequestID]; ok {
+		return fmt.Errorf("pull request %s already exists", pr.PullRequestID)
+	}
+	if _, ok := m.users[pr.AuthorID]; !ok {
+		return fmt.Errorf("author %s not found", pr.AuthorID)
+	}
+	revs := map[string]*memReviewer{}
+	for _, a := range assigned {
+		if _, ok := m.users[a.UserID]; !ok {
+			return fmt.Errorf("reviewer %s not found", a.UserID)
+		}
+		if _, ok := revs[a.UserID]; ok {
+			return fmt.Errorf("reviewer %s assigned twice", a.UserID)
+		}
+		revs[a.UserID] = newMemReviewer(a)
+	}
+	if err := m.checkRotations(rots); err != nil {
+		return err
+	}
+
+	m.advanceRotations(rots)
+	m.recordDecisions(decs)
+	now := time.Now().UTC()
+	status := pr.Status
+	if status == "" {
+		status = model.StatusOpen
+	}
+	m.prs[pr.PullRequestID] = model.PullRequest{
+		PullRequestID:   pr.PullRequestID,
+		PullRequestName: pr.PullRequestName,
+		AuthorID:        pr.AuthorID,
+		Status:          status,
+		Files:           copyStrings(pr.Files),
+		CreatedAt:       &now,
+	}
+	m.reviewers[pr.PullRequestID] = revs
+	return nil
+}
+
+func (m *MemoryStore) checkRotations(rots []Rotation) error {
+	for _, rot := range rots {
+		if _, ok := m.teams[rot.Team]; !ok || m.cursors[rot.Team] != rot.From {
+			return ErrRotationConflict
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) advanceRotations(rots []Rotation) {
+	for _, rot := range rots {
+		m.cursors[rot.Team] = rot.To
+	}
+}
+
+func (m *MemoryStore) recordDecisions(decs []model.Decision) {
+	now := time.Now().UTC()
+	for _, d := range decs {
+		m.lastDec++
+		d.ID = m.lastDec
+		d.CreatedAt = &now
+		d.Requested = copyStrings(d.Requested)
+		d.Draws = append([]model.Draw{}, d.Draws...)
+		d.Excluded = append([]model.Exclusion{}, d.Excluded...)
+		m.decisions[d.PullRequestID] = append(m.decisions[d.PullRequestID], d)
+	}
+}
+
+func (m *MemoryStore) ListDecisions(ctx context.Context, prID string) ([]model.Decision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := []model.Decision{}
+	for _, d := range m.decisions[prID] {
+		d.Requested = copyStrings(d.Requested)
+		d.Draws = append([]model.Draw{}, d.Draws...)
+		d.Excluded = append([]model.Exclusion{}, d.Excluded...)
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) GetRotationCursor(ctx context.Context, teamName string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.teams[teamName]; !ok {
+		return "", sql.ErrNoRows
+	}
+	return m.cursors[teamName], nil
+}
+
+func (m *MemoryStore) GetPullRequest(ctx context.Context, prID string) (model.PullRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.pullRequest(prID)
+}
+
+func (m *MemoryStore) pullRequest(prID string) (model.PullRequest, error) {
+	pr, ok := m.prs[prID]
+	if !ok {
+		return model.PullRequest{}, sql.ErrNoRows
+	}
+	pr.Files = copyStrings(pr.Files)
+	for _, d := range m.declines[prID] {
+		pr.Declines = append(pr.Declines, d)
+	}
+	sort.Slice(pr.Declines, func(i, j int) bool {
+		a, b := pr.Declines[i], pr.Declines[j]
+		if !a.DeclinedAt.Equal(*b.DeclinedAt) {
+			return a.DeclinedAt.Before(*b.DeclinedAt)
+		}
+		return a.UserID < b.UserID
+	})
+	revs := []string{}
+	for uid := range m.reviewers[prID] {
+		revs = append(revs, uid)
+	}
+	sort.Strings(revs)
+	pr.AssignedReviewers = revs
+	pr.Reviews = []model.Review{}
+	for _, uid := range revs {
+		rv := m.reviewers[prID][uid]
+		if rv.fallbackTeam != "" {
+			pr.FallbackReviewers = append(pr.FallbackReviewers, model.FallbackReviewer{UserID: uid, TeamName: rv.fallbackTeam})
+		}
+		assignedAt := rv.assignedAt
+		pr.Reviews = append(pr.Reviews, model.Review{
+			UserID:     uid,
+			State:      rv.state,
+			Comment:    rv.comment,
+			AssignedAt: &assignedAt,
+			DecidedAt:  rv.decidedAt,
+		})
+	}
+	return pr, nil
+}
+
+func (m *MemoryStore) MergePullRequest(ctx context.Context, prID string, check func([]model.Review) error) (model.PullRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pr, ok := m.prs[prID]
+	if !ok {
+		return model.PullRequest{}, sql.ErrNoRows
+	}
+	switch pr.Status {
+	case model.StatusMerged:
+	case model.StatusOpen:
+		if check != nil {
+			full, _ := m.pullRequest(prID)
+			if err := check(full.Reviews); err != nil {
+				return model.PullRequest{}, err
+			}
+		}
+		now := time.Now().UTC()
+		pr.Status = model.StatusMerged
+		pr.MergedAt = &now
+		m.prs[prID] = pr
+	default:
+		return model.PullRequest{}, ErrStatusConflict
+	}
+	return m.pullRequest(prID)
+}
+
+func (m *MemoryStore) SetPullRequestStatus(ctx context.Context, prID, from, to string, assigned []Assignment, repls []Replacement, removed []string, rots []Rotation, decs []model.Decision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pr, ok := m.prs[prID]
+	if !ok || pr.Status != from {
+		return ErrStatusConflict
+	}
+	if (len(repls) > 0 || len(removed) > 0) && to != model.StatusOpen {
+		return ErrStatusConflict
+	}
+	revs := m.reviewers[prID]
+	for _, a := range assigned {
+		if _, ok := m.users[a.UserID]; !ok {
+			return fmt.Errorf("reviewer %s not found", a.UserID)
+		}
+		if _, ok := revs[a.UserID]; ok {
+			return fmt.Errorf("reviewer %s already assigned", a.UserID)
+		}
+	}
+	for _, id := range removed {
+		if !m.assigned(prID, id) {
+			return ErrStatusConflict
+		}
+	}
+	// As in the SQL store, the removed reviewers are gone and the pull
+	// request is OPEN by the time the reviews are handed over.
+	kept := map[string]*memReviewer{}
+	for id, rv := range revs {
+		kept[id] = rv
+	}
+	for _, id := range removed {
+		delete(revs, id)
+	}
+	opened := pr
+	opened.Status = to
+	m.prs[prID] = opened
+	err := m.checkReplacements(repls)
+	if err == nil {
+		err = m.checkRotations(rots)
+	}
+	if err != nil {
+		m.reviewers[prID] = kept
+		m.prs[prID] = pr
+		return err
+	}
+	m.advanceRotations(rots)
+	m.recordDecisions(decs)
+	for _, a := range assigned {
+		revs[a.UserID] = newMemReviewer(a)
+	}
+	m.applyReplacements(repls)
+	pr.Status = to
+	pr.ClosedAt = nil
+	if to == model.StatusClosed {
+		now := time.Now().UTC()
+		pr.ClosedAt = &now
+	}
+	m.prs[prID] = pr
+	return nil
+}
+
+func (m *MemoryStore) GetActiveTeamMembers(ctx context.Context, teamName string, exclude []string) ([]model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	excludeMap := map[string]bool{}
+	for _, e := range exclude {
+		excludeMap[e] = true
+	}
+	now := time.Now().UTC()
+	res := []model.User{}
+	for _, id := range m.userOrder {
+		u := m.users[id]
+		if u.TeamName != teamName || !u.IsActive || excludeMap[u.UserID] || m.isAway(u.UserID, now) {
+			continue
+		}
+		res = append(res, u)
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) isAway(userID string, at time.Time) bool {
+	for _, u := range m.away {
+		if u.UserID == userID && !u.StartsAt.After(at) && u.EndsAt.After(at) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) AddUnavailability(ctx context.Context, u model.Unavailability) (model.Unavailability, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[u.UserID]; !ok {
+		return model.Unavailability{}, fmt.Errorf("user %s not found", u.UserID)
+	}
+	if !u.EndsAt.After(u.StartsAt) {
+		return model.Unavailability{}, fmt.Errorf("unavailability must end after it starts")
+	}
+	m.lastAway++
+	u.ID = m.lastAway
+	u.StartsAt = u.StartsAt.UTC().Truncate(time.Second)
+	u.EndsAt = u.EndsAt.UTC().Truncate(time.Second)
+	m.away = append(m.away, u)
+	return u, nil
+}
+
+func (m *MemoryStore) ListUnavailability(ctx context.Context, userID string) ([]model.Unavailability, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	now := time.Now().UTC()
+	res := []model.Unavailability{}
+	for _, u := range m.away {
+		if u.UserID == userID && u.EndsAt.After(now) {
+			res = append(res, u)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].StartsAt.Equal(res[j].StartsAt) {
+			return res[i].StartsAt.Before(res[j].StartsAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+func (m *MemoryStore) RemoveUnavailability(ctx context.Context, userID string, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, u := range m.away {
+		if u.ID == id && u.UserID == userID {
+			m.away = append(m.away[:i], m.away[i+1:]...)
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (m *MemoryStore) IsUserAssignedToPR(ctx context.Context, prID, userID string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.assigned(prID, userID), nil
+}
+
+func (m *MemoryStore) assigned(prID, userID string) bool {
+	_, ok := m.reviewers[prID][userID]
+	return ok
+}
+
+func (m *MemoryStore) ReplaceReviewer(ctx context.Context, prID, oldUserID string, repl Assignment, rots []Rotation, decs []model.Decision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	repls := []Replacement{{PullRequestID: prID, OldUserID: oldUserID, New: repl}}
+	if err := m.checkReplacements(repls); err != nil {
+		return err
+	}
+	if err := m.checkRotations(rots); err != nil {
+		return err
+	}
+	m.applyReplacements(repls)
+	m.advanceRotations(rots)
+	m.recordDecisions(decs)
+	return nil
+}
+
+func (m *MemoryStore) DeclineReview(ctx context.Context, prID string, d model.Decline, repl *Assignment, rots []Rotation, decs []model.Decision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	repls := []Replacement{}
+	if repl != nil {
+		repls = append(repls, Replacement{PullRequestID: prID, OldUserID: d.UserID, New: *repl})
+	} else if m.prs[prID].Status != model.StatusOpen || !m.assigned(prID, d.UserID) {
+		return ErrStatusConflict
+	}
+	if err := m.checkReplacements(repls); err != nil {
+		return err
+	}
+	if err := m.checkRotations(rots); err != nil {
+		return err
+	}
+	if repl == nil {
+		delete(m.reviewers[prID], d.UserID)
+	}
+	m.applyReplacements(repls)
+	m.advanceRotations(rots)
+	m.recordDecisions(decs)
+	now := time.Now().UTC()
+	d.DeclinedAt = &now
+	if m.declines[prID] == nil {
+		m.declines[prID] = map[string]model.Decline{}
+	}
+	m.declines[prID][d.UserID] = d
+	return nil
+}
+
+func (m *MemoryStore) AddReviewer(ctx context.Context, prID string, a Assignment, decs []model.Decision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pr, ok := m.prs[prID]
+	if !ok || pr.Status != model.StatusOpen || m.assigned(prID, a.UserID) {
+		return ErrStatusConflict
+	}
+	if _, ok := m.users[a.UserID]; !ok {
+		return fmt.Errorf("reviewer %s not found", a.UserID)
+	}
+	m.recordDecisions(decs)
+	m.reviewers[prID][a.UserID] = newMemReviewer(a)
+	return nil
+}
+
+func (m *MemoryStore) RemoveReviewer(ctx context.Context, prID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pr, ok := m.prs[prID]
+	if !ok || pr.Status != model.StatusOpen || !m.assigned(prID, userID) {
+		return ErrStatusConflict
+	}
+	delete(m.reviewers[prID], userID)
+	return nil
+}
+
+func (m *MemoryStore) SetReviewState(ctx context.Context, prID, userID, state, comment string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.prs[prID].Status != model.StatusOpen {
+		return ErrStatusConflict
+	}
+	rv, ok := m.reviewers[prID][userID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	rv.comment = comment
+	if state == model.ReviewCommented && (rv.state == model.ReviewApproved || rv.state == model.ReviewChangesRequested) {
+		return nil
+	}
+	now := time.Now().UTC()
+	rv.state = state
+	rv.decidedAt = &now
+	return nil
+}
+
+func (m *MemoryStore) GetPRsByReviewer(ctx context.Context, userID string) ([]model.PullRequestShort, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := []model.PullRequest{}
+	for id := range m.reviewers {
+		if m.assigned(id, userID) && m.prs[id].Status != model.StatusClosed {
+			list = append(list, m.prs[id])
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(*list[j].CreatedAt)
+	})
+	res := []model.PullRequestShort{}
+	for _, pr := range list {
+		res = append(res, model.PullRequestShort{
+			PullRequestID:   pr.PullRequestID,
+			PullRequestName: pr.PullRequestName,
+			AuthorID:        pr.AuthorID,
+			Status:          pr.Status,
+		})
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) GetOpenPullRequestsByReviewers(ctx context.Context, userIDs []string) ([]model.PullRequest, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := []model.PullRequest{}
+	for id, pr := range m.prs {
+		if pr.Status != model.StatusOpen {
+			continue
+		}
+		for _, uid := range userIDs {
+			if m.assigned(id, uid) {
+				full, _ := m.pullRequest(id)
+				res = append(res, model.PullRequest{
+					PullRequestID:     full.PullRequestID,
+					PullRequestName:   full.PullRequestName,
+					AuthorID:          full.AuthorID,
+					Status:            full.Status,
+					AssignedReviewers: full.AssignedReviewers,
+					Files:             full.Files,
+					Declines:          full.Declines,
+					CreatedAt:         full.CreatedAt,
+				})
+				break
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(*res[j].CreatedAt) {
+			return res[i].CreatedAt.Before(*res[j].CreatedAt)
+		}
+		return res[i].PullRequestID < res[j].PullRequestID
+	})
+	return res, nil
+}
+
+func (m *MemoryStore) CountOpenReviews(ctx context.Context, userIDs []string) (map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	res := map[string]int{}
+	for _, uid := range userIDs {
+		for id := range m.reviewers {
+			if m.assigned(id, uid) && m.prs[id].Status == model.StatusOpen {
+				res[uid]++
+			}
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) CountRecentReviews(ctx context.Context, limits map[string]int) (map[string]map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	byAuthor := map[string][]model.PullRequest{}
+	for _, pr := range m.prs {
+		if _, ok := limits[pr.AuthorID]; ok {
+			byAuthor[pr.AuthorID] = append(byAuthor[pr.AuthorID], pr)
+		}
+	}
+	res := map[string]map[string]int{}
+	for author, limit := range limits {
+		prs := byAuthor[author]
+		sort.Slice(prs, func(i, j int) bool {
+			if !prs[i].CreatedAt.Equal(*prs[j].CreatedAt) {
+				return prs[i].CreatedAt.After(*prs[j].CreatedAt)
+			}
+			return prs[i].PullRequestID > prs[j].PullRequestID
+		})
+		res[author] = map[string]int{}
+		for i := 0; i < limit && i < len(prs); i++ {
+			for uid := range m.reviewers[prs[i].PullRequestID] {
+				res[author][uid]++
+			}
+		}
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) AddUserToTeam(ctx context.Context, teamName string, u model.User) (model.Team, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[u.UserID]; ok {
+		return model.Team{}, fmt.Errorf("user_id %s already exists", u.UserID)
+	}
+	if _, ok := m.teams[teamName]; !ok {
+		return model.Team{}, fmt.Errorf("team %s not found", teamName)
+	}
+	u.TeamName = teamName
+	u.MaxOpenReviews = copyInt(u.MaxOpenReviews)
+	m.insertUser(u)
+	return m.team(teamName), nil
+}
+
+func (m *MemoryStore) RemoveUserFromTeam(ctx context.Context, teamName, userID string) (model.Team, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[userID]
+	if !ok || u.TeamName != teamName {
+		return model.Team{}, fmt.Errorf("user_id %s not found in team %s", userID, teamName)
+	}
+	for id, pr := range m.prs {
+		if pr.AuthorID == userID || m.assigned(id, userID) {
+			return model.Team{}, fmt.Errorf("user_id %s is referenced by pull request %s", userID, id)
+		}
+	}
+	delete(m.users, userID)
+	away := m.away[:0]
+	for _, u := range m.away {
+		if u.UserID != userID {
+			away = append(away, u)
+		}
+	}
+	m.away = away
+	for _, ds := range m.declines {
+		delete(ds, userID)
+	}
+	for i, id := range m.userOrder {
+		if id == userID {
+			m.userOrder = append(m.userOrder[:i], m.userOrder[i+1:]...)
+			break
+		}
+	}
+	return m.team(teamName), nil
+}
@@ -0,0 +1,13 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/storage"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) storage.Store {
+		return storage.NewMemoryStore()
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -22,6 +23,17 @@ func NewDBFromEnv() (*sql.DB, error) {
 	return sql.Open("postgres", dsn)
 }
 
+// QueryTimeoutFromEnv reads DB_QUERY_TIMEOUT, a Go duration such as "3s".
+// "0" disables the extra deadline.
+func QueryTimeoutFromEnv() (time.Duration, error) {
+	v := getEnv("DB_QUERY_TIMEOUT", "3s")
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("bad DB_QUERY_TIMEOUT %q: %w", v, err)
+	}
+	return d, nil
+}
+
 func getEnv(key, defaultValue string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
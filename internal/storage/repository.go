@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/ilya2044/avito2025/internal/model"
@@ -10,26 +14,41 @@ import (
 
 type Repository struct {
 	DB *sql.DB
+	// QueryTimeout bounds every repository call on top of the caller's
+	// context. Zero means no extra deadline.
+	QueryTimeout time.Duration
+	// forUpdate is appended to SELECTs that lock the rows they read.
+	// SQLite has no row locks and is left without it.
+	forUpdate string
 }
 
 func NewRepository(db *sql.DB) *Repository {
-	return &Repository{DB: db}
+	return &Repository{DB: db, forUpdate: " FOR UPDATE"}
 }
 
-func (r *Repository) ApplyMigrations(migrationSQL string) error {
-	_, err := r.DB.Exec(migrationSQL)
-	return err
+// Close closes the underlying connection pool.
+func (r *Repository) Close() error {
+	return r.DB.Close()
+}
+
+func (r *Repository) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, r.QueryTimeout)
 }
 
-func (r *Repository) CreateTeam(team model.Team) error {
-	tx, err := r.DB.Begin()
+func (r *Repository) CreateTeam(ctx context.Context, team model.Team) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
 	var exists bool
-	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM teams WHERE team_name=$1)", team.TeamName).Scan(&exists)
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM teams WHERE team_name=$1)", team.TeamName).Scan(&exists)
 	if err != nil {
 		return err
 	}
@@ -39,7 +58,7 @@ func (r *Repository) CreateTeam(team model.Team) error {
 
 	for _, m := range team.Members {
 		var userExists bool
-		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE user_id=$1)", m.UserID).Scan(&userExists)
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE user_id=$1)", m.UserID).Scan(&userExists)
 		if err != nil {
 			return err
 		}
@@ -48,15 +67,27 @@ func (r *Repository) CreateTeam(team model.Team) error {
 		}
 	}
 
-	_, err = tx.Exec("INSERT INTO teams(team_name) VALUES($1)", team.TeamName)
+	settings := model.DefaultTeamSettings()
+	if team.Settings != nil {
+		settings = *team.Settings
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO teams(team_name, assignment_strategy, min_reviewers, max_reviewers, required_approvals, pairing_history)
+		VALUES($1,$2,$3,$4,$5,$6)`,
+		team.TeamName, settings.AssignmentStrategy, settings.MinReviewers, settings.MaxReviewers, settings.RequiredApprovals, settings.PairingHistory)
 	if err != nil {
 		return err
 	}
+	if err := insertFallbacks(ctx, tx, team.TeamName, settings.FallbackTeams); err != nil {
+		return err
+	}
+	if err := insertOwnershipRules(ctx, tx, team.TeamName, settings.OwnershipRules); err != nil {
+		return err
+	}
 
 	for _, m := range team.Members {
-		_, err = tx.Exec(`INSERT INTO users(user_id, username, team_name, is_active)
-			VALUES($1,$2,$3,$4)`,
-			m.UserID, m.Username, team.TeamName, m.IsActive)
+		_, err = tx.ExecContext(ctx, `INSERT INTO users(user_id, username, team_name, is_active, weight, tier)
+			VALUES($1,$2,$3,$4,$5,$6)`,
+			m.UserID, m.Username, team.TeamName, m.IsActive, m.Weight, nullString(m.Tier))
 		if err != nil {
 			return fmt.Errorf("cannot add user %s: %w", m.UserID, err)
 		}
@@ -65,10 +96,12 @@ func (r *Repository) CreateTeam(team model.Team) error {
 	return tx.Commit()
 }
 
-func (r *Repository) GetTeam(teamName string) (model.Team, error) {
+func (r *Repository) GetTeam(ctx context.Context, teamName string) (model.Team, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	var t model.Team
 	t.TeamName = teamName
-	rows, err := r.DB.Query("SELECT user_id, username, is_active FROM users WHERE team_name=$1", teamName)
+	rows, err := r.DB.QueryContext(ctx, "SELECT user_id, username, is_active, weight, tier FROM users WHERE team_name=$1", teamName)
 	if err != nil {
 		return t, err
 	}
@@ -76,58 +109,434 @@ func (r *Repository) GetTeam(teamName string) (model.Team, error) {
 	members := []model.TeamMember{}
 	for rows.Next() {
 		var m model.TeamMember
-		if err := rows.Scan(&m.UserID, &m.Username, &m.IsActive); err != nil {
+		var tier sql.NullString
+		if err := rows.Scan(&m.UserID, &m.Username, &m.IsActive, &m.Weight, &tier); err != nil {
 			return t, err
 		}
+		m.Tier = tier.String
 		members = append(members, m)
 	}
 	t.Members = members
+	settings, err := r.GetTeamSettings(ctx, teamName)
+	if err == nil {
+		t.Settings = &settings
+	} else if err != sql.ErrNoRows {
+		return t, err
+	}
 	return t, nil
 }
 
-func (r *Repository) SetUserIsActive(userID string, isActive bool) (model.User, error) {
-	_, err := r.DB.Exec("UPDATE users SET is_active=$1 WHERE user_id=$2", isActive, userID)
+func (r *Repository) GetTeamSettings(ctx context.Context, teamName string) (model.TeamSettings, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var s model.TeamSettings
+	err := r.DB.QueryRowContext(ctx, `SELECT assignment_strategy, min_reviewers, max_reviewers, required_approvals, pairing_history
+FROM teams WHERE team_name=$1`, teamName).
+		Scan(&s.AssignmentStrategy, &s.MinReviewers, &s.MaxReviewers, &s.RequiredApprovals, &s.PairingHistory)
+	if err != nil {
+		return s, err
+	}
+	rows, err := r.DB.QueryContext(ctx, "SELECT fallback_team FROM team_fallbacks WHERE team_name=$1 ORDER BY priority", teamName)
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+	s.FallbackTeams = []string{}
+	for rows.Next() {
+		var fb string
+		if err := rows.Scan(&fb); err != nil {
+			return s, err
+		}
+		s.FallbackTeams = append(s.FallbackTeams, fb)
+	}
+	if err := rows.Err(); err != nil {
+		return s, err
+	}
+	rows, err = r.DB.QueryContext(ctx, "SELECT pattern, owners FROM team_ownership_rules WHERE team_name=$1 ORDER BY position", teamName)
+	if err != nil {
+		return s, err
+	}
+	defer rows.Close()
+	s.OwnershipRules = []model.OwnershipRule{}
+	for rows.Next() {
+		var rule model.OwnershipRule
+		var owners string
+		if err := rows.Scan(&rule.Pattern, &owners); err != nil {
+			return s, err
+		}
+		rule.Owners = strings.Fields(owners)
+		s.OwnershipRules = append(s.OwnershipRules, rule)
+	}
+	return s, rows.Err()
+}
+
+func (r *Repository) UpdateTeamSettings(ctx context.Context, teamName string, s model.TeamSettings) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.ExecContext(ctx, `UPDATE teams SET assignment_strategy=$1, min_reviewers=$2, max_reviewers=$3, required_approvals=$4,
+  pairing_history=$5
+WHERE team_name=$6`,
+		s.AssignmentStrategy, s.MinReviewers, s.MaxReviewers, s.RequiredApprovals, s.PairingHistory, teamName)
+	if err != nil {
+		return err
+	}
+	cnt, _ := res.RowsAffected()
+	if cnt == 0 {
+		return sql.ErrNoRows
+	}
+	if err := insertFallbacks(ctx, tx, teamName, s.FallbackTeams); err != nil {
+		return err
+	}
+	if err := insertOwnershipRules(ctx, tx, teamName, s.OwnershipRules); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertFallbacks replaces the team's fallback list, keeping its order
+// as the priority.
+func insertFallbacks(ctx context.Context, tx *sql.Tx, teamName string, fallbacks []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM team_fallbacks WHERE team_name=$1", teamName); err != nil {
+		return err
+	}
+	for i, fb := range fallbacks {
+		_, err := tx.ExecContext(ctx, "INSERT INTO team_fallbacks(team_name, fallback_team, priority) VALUES($1,$2,$3)",
+			teamName, fb, i)
+		if err != nil {
+			return fmt.Errorf("cannot add fallback team %s: %w", fb, err)
+		}
+	}
+	return nil
+}
+
+// insertOwnershipRules replaces the team's ownership rules, keeping
+// their order.
+func insertOwnershipRules(ctx context.Context, tx *sql.Tx, teamName string, rules []model.OwnershipRule) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM team_ownership_rules WHERE team_name=$1", teamName); err != nil {
+		return err
+	}
+	for i, rule := range rules {
+		_, err := tx.ExecContext(ctx, "INSERT INTO team_ownership_rules(team_name, position, pattern, owners) VALUES($1,$2,$3,$4)",
+			teamName, i, rule.Pattern, strings.Join(rule.Owners, " "))
+		if err != nil {
+			return fmt.Errorf("cannot add ownership rule %s: %w", rule.Pattern, err)
+		}
+	}
+	return nil
+}
+
+func (r *Repository) SetUserIsActive(ctx context.Context, userID string, isActive bool) (model.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	_, err := r.DB.ExecContext(ctx, "UPDATE users SET is_active=$1 WHERE user_id=$2", isActive, userID)
 	if err != nil {
 		return model.User{}, err
 	}
-	var u model.User
-	err = r.DB.QueryRow("SELECT user_id, username, team_name, is_active FROM users WHERE user_id=$1", userID).
-		Scan(&u.UserID, &u.Username, &u.TeamName, &u.IsActive)
-	return u, err
+	return scanUser(r.DB.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE user_id=$1", userID))
+}
+
+func (r *Repository) DeactivateUsers(ctx context.Context, userIDs []string, repls []Replacement, rots []Rotation, decs []model.Decision) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, ids := range chunks(userIDs, batchSize) {
+		_, err = tx.ExecContext(ctx, "UPDATE users SET is_active=false WHERE user_id IN ("+placeholders(1, len(ids))+")",
+			stringArgs(ids)...)
+		if err != nil {
+			return err
+		}
+	}
+	for from := 0; from < len(repls); from += batchSize / 4 {
+		batch := repls[from:min(from+batchSize/4, len(repls))]
+		if err := replaceReviewers(ctx, tx, batch); err != nil {
+			return err
+		}
+	}
+	if err := advanceRotations(ctx, tx, rots); err != nil {
+		return err
+	}
+	if err := insertDecisions(ctx, tx, decs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// replaceReviewers applies a batch of replacements with one DELETE and
+// one INSERT. Replacements on pull requests that are no longer OPEN, or
+// of reviewers no longer assigned, make it fail with ErrStatusConflict.
+// The pull requests stay locked for the rest of tx, so a merge cannot
+// check their reviews halfway through.
+func replaceReviewers(ctx context.Context, tx *sql.Tx, repls []Replacement) error {
+	prIDs := []string{}
+	for _, rp := range repls {
+		if !containsString(prIDs, rp.PullRequestID) {
+			prIDs = append(prIDs, rp.PullRequestID)
+		}
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE pull_requests SET status=status WHERE status=$1 AND pull_request_id IN ("+placeholders(2, len(prIDs))+")",
+		append([]interface{}{model.StatusOpen}, stringArgs(prIDs)...)...)
+	if err != nil {
+		return err
+	}
+	if cnt, _ := res.RowsAffected(); cnt != int64(len(prIDs)) {
+		return ErrStatusConflict
+	}
+	pairs := make([]string, len(repls))
+	args := []interface{}{model.StatusOpen}
+	for i, rp := range repls {
+		pairs[i] = "(" + placeholders(2+2*i, 2) + ")"
+		args = append(args, rp.PullRequestID, rp.OldUserID)
+	}
+	res, err = tx.ExecContext(ctx, `DELETE FROM pr_reviewers
+WHERE pr_id IN (SELECT pull_request_id FROM pull_requests WHERE status=$1)
+AND (pr_id, user_id) IN (VALUES `+strings.Join(pairs, ", ")+`)`, args...)
+	if err != nil {
+		return err
+	}
+	cnt, _ := res.RowsAffected()
+	if cnt != int64(len(repls)) {
+		return ErrStatusConflict
+	}
+	rows := make([]string, len(repls))
+	args = []interface{}{}
+	now := time.Now().UTC()
+	for i, rp := range repls {
+		rows[i] = "(" + placeholders(1+4*i, 4) + ")"
+		args = append(args, rp.PullRequestID, rp.New.UserID, nullString(rp.New.FallbackTeam), now)
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO pr_reviewers(pr_id, user_id, fallback_team, assigned_at) VALUES "+strings.Join(rows, ", "),
+		args...)
+	return err
+}
+
+func (r *Repository) GetUser(ctx context.Context, userID string) (model.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return scanUser(r.DB.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE user_id=$1", userID))
+}
+
+func (r *Repository) SetUserCapacity(ctx context.Context, userID string, limit *int) (model.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.DB.ExecContext(ctx, "UPDATE users SET max_open_reviews=$1 WHERE user_id=$2", nullInt(limit), userID)
+	if err != nil {
+		return model.User{}, err
+	}
+	cnt, _ := res.RowsAffected()
+	if cnt == 0 {
+		return model.User{}, sql.ErrNoRows
+	}
+	return scanUser(r.DB.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE user_id=$1", userID))
 }
 
-func (r *Repository) GetUser(userID string) (model.User, error) {
+func (r *Repository) SetUserProfile(ctx context.Context, userID string, weight float64, tier string) (model.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.DB.ExecContext(ctx, "UPDATE users SET weight=$1, tier=$2 WHERE user_id=$3", weight, nullString(tier), userID)
+	if err != nil {
+		return model.User{}, err
+	}
+	cnt, _ := res.RowsAffected()
+	if cnt == 0 {
+		return model.User{}, sql.ErrNoRows
+	}
+	return scanUser(r.DB.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE user_id=$1", userID))
+}
+
+const userColumns = "user_id, username, team_name, is_active, max_open_reviews, weight, tier"
+
+// scanUser reads a row selected with userColumns.
+func scanUser(row interface{ Scan(...interface{}) error }) (model.User, error) {
 	var u model.User
-	err := r.DB.QueryRow("SELECT user_id, username, team_name, is_active FROM users WHERE user_id=$1", userID).
-		Scan(&u.UserID, &u.Username, &u.TeamName, &u.IsActive)
-	return u, err
+	var limit sql.NullInt64
+	var tier sql.NullString
+	if err := row.Scan(&u.UserID, &u.Username, &u.TeamName, &u.IsActive, &limit, &u.Weight, &tier); err != nil {
+		return u, err
+	}
+	u.Tier = tier.String
+	if limit.Valid {
+		n := int(limit.Int64)
+		u.MaxOpenReviews = &n
+	}
+	return u, nil
+}
+
+func (r *Repository) GetUsers(ctx context.Context, userIDs []string) ([]model.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res := []model.User{}
+	for _, ids := range chunks(userIDs, batchSize) {
+		rows, err := r.DB.QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE user_id IN ("+
+			placeholders(1, len(ids))+")", stringArgs(ids)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			u, err := scanUser(rows)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			res = append(res, u)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
 }
 
-func (r *Repository) CreatePullRequest(pr model.PullRequest, assigned []string) error {
-	tx, err := r.DB.Begin()
+func (r *Repository) CreatePullRequest(ctx context.Context, pr model.PullRequest, assigned []Assignment, rots []Rotation, decs []model.Decision) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(`INSERT INTO pull_requests(pull_request_id, pull_request_name, author_id, status) VALUES($1,$2,$3,'OPEN')`,
-		pr.PullRequestID, pr.PullRequestName, pr.AuthorID)
+	status := pr.Status
+	if status == "" {
+		status = model.StatusOpen
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO pull_requests(pull_request_id, pull_request_name, author_id, status) VALUES($1,$2,$3,$4)`,
+		pr.PullRequestID, pr.PullRequestName, pr.AuthorID, status)
 	if err != nil {
 		return err
 	}
-	for _, uid := range assigned {
-		_, err = tx.Exec("INSERT INTO pr_reviewers(pr_id, user_id) VALUES($1,$2)", pr.PullRequestID, uid)
+	for _, path := range pr.Files {
+		_, err := tx.ExecContext(ctx, "INSERT INTO pull_request_files(pr_id, path) VALUES($1,$2)", pr.PullRequestID, path)
 		if err != nil {
+			return fmt.Errorf("cannot add file %s: %w", path, err)
+		}
+	}
+	for _, a := range assigned {
+		if err := insertReviewer(ctx, tx, pr.PullRequestID, a); err != nil {
 			return err
 		}
 	}
+	if err := advanceRotations(ctx, tx, rots); err != nil {
+		return err
+	}
+	if err := insertDecisions(ctx, tx, decs); err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
-func (r *Repository) GetPullRequest(prID string) (model.PullRequest, error) {
+func insertReviewer(ctx context.Context, tx *sql.Tx, prID string, a Assignment) error {
+	_, err := tx.ExecContext(ctx, "INSERT INTO pr_reviewers(pr_id, user_id, fallback_team, assigned_at) VALUES($1,$2,$3,$4)",
+		prID, a.UserID, nullString(a.FallbackTeam), time.Now().UTC())
+	return err
+}
+
+func advanceRotations(ctx context.Context, tx *sql.Tx, rots []Rotation) error {
+	for _, rot := range rots {
+		res, err := tx.ExecContext(ctx, "UPDATE teams SET rr_cursor=$1 WHERE team_name=$2 AND COALESCE(rr_cursor, '')=$3",
+			rot.To, rot.Team, rot.From)
+		if err != nil {
+			return err
+		}
+		cnt, _ := res.RowsAffected()
+		if cnt == 0 {
+			return ErrRotationConflict
+		}
+	}
+	return nil
+}
+
+// insertDecisions records assignment decisions in batches.
+func insertDecisions(ctx context.Context, tx *sql.Tx, decs []model.Decision) error {
+	now := time.Now().UTC()
+	for len(decs) > 0 {
+		batch := decs[:min(len(decs), batchSize/7)]
+		decs = decs[len(batch):]
+		rows := make([]string, len(batch))
+		args := []interface{}{}
+		for i, d := range batch {
+			draws, err := json.Marshal(d.Draws)
+			if err != nil {
+				return err
+			}
+			excluded, err := json.Marshal(d.Excluded)
+			if err != nil {
+				return err
+			}
+			requested, err := json.Marshal(append([]string{}, d.Requested...))
+			if err != nil {
+				return err
+			}
+			rows[i] = "(" + placeholders(1+7*i, 7) + ")"
+			args = append(args, d.PullRequestID, d.Action, nullString(d.ReplacedUserID), string(requested), string(draws), string(excluded), now)
+		}
+		_, err := tx.ExecContext(ctx, "INSERT INTO assignment_decisions(pr_id, action, replaced_user_id, requested, draws, excluded, created_at) VALUES "+
+			strings.Join(rows, ", "), args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Repository) ListDecisions(ctx context.Context, prID string) ([]model.Decision, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.DB.QueryContext(ctx, `SELECT id, pr_id, action, replaced_user_id, requested, draws, excluded, created_at
+FROM assignment_decisions WHERE pr_id=$1 ORDER BY id`, prID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []model.Decision{}
+	for rows.Next() {
+		var d model.Decision
+		var replaced sql.NullString
+		var requested, draws, excluded string
+		var createdAt time.Time
+		if err := rows.Scan(&d.ID, &d.PullRequestID, &d.Action, &replaced, &requested, &draws, &excluded, &createdAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(requested), &d.Requested); err != nil {
+			return nil, fmt.Errorf("decision %d: %w", d.ID, err)
+		}
+		if err := json.Unmarshal([]byte(draws), &d.Draws); err != nil {
+			return nil, fmt.Errorf("decision %d: %w", d.ID, err)
+		}
+		if err := json.Unmarshal([]byte(excluded), &d.Excluded); err != nil {
+			return nil, fmt.Errorf("decision %d: %w", d.ID, err)
+		}
+		d.ReplacedUserID = replaced.String
+		d.CreatedAt = &createdAt
+		res = append(res, d)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repository) GetRotationCursor(ctx context.Context, teamName string) (string, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var cursor sql.NullString
+	err := r.DB.QueryRowContext(ctx, "SELECT rr_cursor FROM teams WHERE team_name=$1", teamName).Scan(&cursor)
+	return cursor.String, err
+}
+
+func (r *Repository) GetPullRequest(ctx context.Context, prID string) (model.PullRequest, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	var pr model.PullRequest
-	var createdAt, mergedAt sql.NullTime
-	err := r.DB.QueryRow("SELECT pull_request_id, pull_request_name, author_id, status, created_at, merged_at FROM pull_requests WHERE pull_request_id=$1", prID).
-		Scan(&pr.PullRequestID, &pr.PullRequestName, &pr.AuthorID, &pr.Status, &createdAt, &mergedAt)
+	var createdAt, mergedAt, closedAt sql.NullTime
+	err := r.DB.QueryRowContext(ctx, `SELECT pull_request_id, pull_request_name, author_id, status, created_at, merged_at, closed_at
+FROM pull_requests WHERE pull_request_id=$1`, prID).
+		Scan(&pr.PullRequestID, &pr.PullRequestName, &pr.AuthorID, &pr.Status, &createdAt, &mergedAt, &closedAt)
 	if err != nil {
 		return pr, err
 	}
@@ -139,63 +548,206 @@ func (r *Repository) GetPullRequest(prID string) (model.PullRequest, error) {
 		t := mergedAt.Time
 		pr.MergedAt = &t
 	}
-	rows, err := r.DB.Query("SELECT user_id FROM pr_reviewers WHERE pr_id=$1 ORDER BY user_id", prID)
+	pr.ClosedAt = timePtr(closedAt)
+	files, err := r.pullRequestFiles(ctx, []string{prID})
+	if err != nil {
+		return pr, err
+	}
+	pr.Files = files[prID]
+	declines, err := r.pullRequestDeclines(ctx, []string{prID})
+	if err != nil {
+		return pr, err
+	}
+	pr.Declines = declines[prID]
+	rows, err := r.DB.QueryContext(ctx, `SELECT user_id, fallback_team, state, comment, assigned_at, decided_at
+FROM pr_reviewers WHERE pr_id=$1 ORDER BY user_id`, prID)
 	if err != nil {
 		return pr, err
 	}
 	defer rows.Close()
 	revs := []string{}
+	pr.Reviews = []model.Review{}
 	for rows.Next() {
-		var uid string
-		if err := rows.Scan(&uid); err != nil {
+		var rv model.Review
+		var fallback, comment sql.NullString
+		var assignedAt, decidedAt sql.NullTime
+		if err := rows.Scan(&rv.UserID, &fallback, &rv.State, &comment, &assignedAt, &decidedAt); err != nil {
 			return pr, err
 		}
-		revs = append(revs, uid)
+		revs = append(revs, rv.UserID)
+		if fallback.Valid {
+			pr.FallbackReviewers = append(pr.FallbackReviewers, model.FallbackReviewer{UserID: rv.UserID, TeamName: fallback.String})
+		}
+		rv.Comment = comment.String
+		rv.AssignedAt = timePtr(assignedAt)
+		rv.DecidedAt = timePtr(decidedAt)
+		pr.Reviews = append(pr.Reviews, rv)
 	}
 	pr.AssignedReviewers = revs
-	return pr, nil
+	return pr, rows.Err()
 }
 
-func (r *Repository) MergePullRequest(prID string) (model.PullRequest, error) {
-	tx, err := r.DB.Begin()
+func (r *Repository) MergePullRequest(ctx context.Context, prID string, check func([]model.Review) error) (model.PullRequest, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return model.PullRequest{}, err
 	}
 	defer tx.Rollback()
 	var status string
 	var mergedAt sql.NullTime
-	err = tx.QueryRow("SELECT status, merged_at FROM pull_requests WHERE pull_request_id=$1 FOR UPDATE", prID).Scan(&status, &mergedAt)
+	err = tx.QueryRowContext(ctx, "SELECT status, merged_at FROM pull_requests WHERE pull_request_id=$1"+r.forUpdate, prID).Scan(&status, &mergedAt)
 	if err != nil {
 		return model.PullRequest{}, err
 	}
-	if status == "MERGED" {
-		return r.GetPullRequest(prID)
+	switch status {
+	case model.StatusMerged:
+		return r.GetPullRequest(ctx, prID)
+	case model.StatusOpen:
+	default:
+		return model.PullRequest{}, ErrStatusConflict
+	}
+	if check != nil {
+		reviews, err := reviewStates(ctx, tx, prID)
+		if err != nil {
+			return model.PullRequest{}, err
+		}
+		if err := check(reviews); err != nil {
+			return model.PullRequest{}, err
+		}
 	}
 	now := time.Now().UTC()
-	_, err = tx.Exec("UPDATE pull_requests SET status='MERGED', merged_at=$1 WHERE pull_request_id=$2", now, prID)
+	_, err = tx.ExecContext(ctx, "UPDATE pull_requests SET status=$1, merged_at=$2 WHERE pull_request_id=$3", model.StatusMerged, now, prID)
 	if err != nil {
 		return model.PullRequest{}, err
 	}
 	if err := tx.Commit(); err != nil {
 		return model.PullRequest{}, err
 	}
-	return r.GetPullRequest(prID)
+	return r.GetPullRequest(ctx, prID)
 }
 
-func (r *Repository) GetActiveTeamMembers(teamName string, exclude []string) ([]model.User, error) {
+// reviewStates returns the reviewers of the pull request with their
+// current state.
+func reviewStates(ctx context.Context, tx *sql.Tx, prID string) ([]model.Review, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT user_id, state FROM pr_reviewers WHERE pr_id=$1 ORDER BY user_id", prID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []model.Review{}
+	for rows.Next() {
+		var rv model.Review
+		if err := rows.Scan(&rv.UserID, &rv.State); err != nil {
+			return nil, err
+		}
+		res = append(res, rv)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repository) SetPullRequestStatus(ctx context.Context, prID, from, to string, assigned []Assignment, repls []Replacement, removed []string, rots []Rotation, decs []model.Decision) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var closedAt sql.NullTime
+	if to == model.StatusClosed {
+		closedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE pull_requests SET status=$1, closed_at=$2 WHERE pull_request_id=$3 AND status=$4",
+		to, closedAt, prID, from)
+	if err != nil {
+		return err
+	}
+	cnt, _ := res.RowsAffected()
+	if cnt == 0 {
+		return ErrStatusConflict
+	}
+	for _, a := range assigned {
+		if err := insertReviewer(ctx, tx, prID, a); err != nil {
+			return err
+		}
+	}
+	// The pull request is OPEN by now if it is to be, which the
+	// reviewer changes below require.
+	for _, id := range removed {
+		if err := removeReviewer(ctx, tx, prID, id); err != nil {
+			return err
+		}
+	}
+	if len(repls) > 0 {
+		if err := replaceReviewers(ctx, tx, repls); err != nil {
+			return err
+		}
+	}
+	if err := advanceRotations(ctx, tx, rots); err != nil {
+		return err
+	}
+	if err := insertDecisions(ctx, tx, decs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) SetReviewState(ctx context.Context, prID, userID, state, comment string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Holding the pull request's row keeps a merge from checking the
+	// reviews while one of them changes.
+	if err := lockOpenPullRequest(ctx, tx, prID); err != nil {
+		return err
+	}
+	if state == model.ReviewCommented {
+		res, err := tx.ExecContext(ctx, "UPDATE pr_reviewers SET comment=$1 WHERE pr_id=$2 AND user_id=$3 AND state IN ($4, $5)",
+			nullString(comment), prID, userID, model.ReviewApproved, model.ReviewChangesRequested)
+		if err != nil {
+			return err
+		}
+		if cnt, _ := res.RowsAffected(); cnt > 0 {
+			return tx.Commit()
+		}
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE pr_reviewers SET state=$1, comment=$2, decided_at=$3 WHERE pr_id=$4 AND user_id=$5",
+		state, nullString(comment), time.Now().UTC(), prID, userID)
+	if err != nil {
+		return err
+	}
+	cnt, _ := res.RowsAffected()
+	if cnt == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) GetActiveTeamMembers(ctx context.Context, teamName string, exclude []string) ([]model.User, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	excludeMap := map[string]bool{}
 	for _, e := range exclude {
 		excludeMap[e] = true
 	}
-	rows, err := r.DB.Query("SELECT user_id, username, team_name, is_active FROM users WHERE team_name=$1 AND is_active=true", teamName)
+	rows, err := r.DB.QueryContext(ctx, `SELECT `+userColumns+` FROM users
+WHERE team_name=$1 AND is_active=true AND NOT EXISTS (
+  SELECT 1 FROM user_unavailability ua
+  WHERE ua.user_id = users.user_id AND ua.starts_at <= $2 AND ua.ends_at > $2)`, teamName, now())
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	res := []model.User{}
 	for rows.Next() {
-		var u model.User
-		if err := rows.Scan(&u.UserID, &u.Username, &u.TeamName, &u.IsActive); err != nil {
+		u, err := scanUser(rows)
+		if err != nil {
 			return nil, err
 		}
 		if excludeMap[u.UserID] {
@@ -206,35 +758,194 @@ func (r *Repository) GetActiveTeamMembers(teamName string, exclude []string) ([]
 	return res, nil
 }
 
-func (r *Repository) IsUserAssignedToPR(prID, userID string) (bool, error) {
+func (r *Repository) AddUnavailability(ctx context.Context, u model.Unavailability) (model.Unavailability, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	u.StartsAt = u.StartsAt.UTC().Truncate(time.Second)
+	u.EndsAt = u.EndsAt.UTC().Truncate(time.Second)
+	err := r.DB.QueryRowContext(ctx, `INSERT INTO user_unavailability(user_id, starts_at, ends_at, reason)
+VALUES($1,$2,$3,$4) RETURNING id`, u.UserID, u.StartsAt, u.EndsAt, u.Reason).Scan(&u.ID)
+	return u, err
+}
+
+func (r *Repository) ListUnavailability(ctx context.Context, userID string) ([]model.Unavailability, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.DB.QueryContext(ctx, `SELECT id, user_id, starts_at, ends_at, reason FROM user_unavailability
+WHERE user_id=$1 AND ends_at > $2 ORDER BY starts_at, id`, userID, now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []model.Unavailability{}
+	for rows.Next() {
+		var u model.Unavailability
+		if err := rows.Scan(&u.ID, &u.UserID, &u.StartsAt, &u.EndsAt, &u.Reason); err != nil {
+			return nil, err
+		}
+		res = append(res, u)
+	}
+	return res, rows.Err()
+}
+
+func (r *Repository) RemoveUnavailability(ctx context.Context, userID string, id int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.DB.ExecContext(ctx, "DELETE FROM user_unavailability WHERE id=$1 AND user_id=$2", id, userID)
+	if err != nil {
+		return err
+	}
+	cnt, _ := res.RowsAffected()
+	if cnt == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *Repository) IsUserAssignedToPR(ctx context.Context, prID, userID string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	var cnt int
-	err := r.DB.QueryRow("SELECT COUNT(1) FROM pr_reviewers WHERE pr_id=$1 AND user_id=$2", prID, userID).Scan(&cnt)
+	err := r.DB.QueryRowContext(ctx, "SELECT COUNT(1) FROM pr_reviewers WHERE pr_id=$1 AND user_id=$2", prID, userID).Scan(&cnt)
 	return cnt > 0, err
 }
 
-func (r *Repository) ReplaceReviewer(prID, oldUserID, newUserID string) error {
-	tx, err := r.DB.Begin()
+func (r *Repository) ReplaceReviewer(ctx context.Context, prID, oldUserID string, repl Assignment, rots []Rotation, decs []model.Decision) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := replaceReviewers(ctx, tx, []Replacement{{PullRequestID: prID, OldUserID: oldUserID, New: repl}}); err != nil {
+		return err
+	}
+	if err := advanceRotations(ctx, tx, rots); err != nil {
+		return err
+	}
+	if err := insertDecisions(ctx, tx, decs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) DeclineReview(ctx context.Context, prID string, d model.Decline, repl *Assignment, rots []Rotation, decs []model.Decision) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec("DELETE FROM pr_reviewers WHERE pr_id=$1 AND user_id=$2", prID, oldUserID)
+	if repl == nil {
+		err = removeReviewer(ctx, tx, prID, d.UserID)
+	} else {
+		err = replaceReviewers(ctx, tx, []Replacement{{PullRequestID: prID, OldUserID: d.UserID, New: *repl}})
+	}
 	if err != nil {
 		return err
 	}
-	_, err = tx.Exec("INSERT INTO pr_reviewers(pr_id, user_id) VALUES($1,$2)", prID, newUserID)
+	_, err = tx.ExecContext(ctx, "DELETE FROM review_declines WHERE pr_id=$1 AND user_id=$2", prID, d.UserID)
 	if err != nil {
 		return err
 	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO review_declines(pr_id, user_id, reason, declined_at) VALUES ($1,$2,$3,$4)",
+		prID, d.UserID, d.Reason, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if err := advanceRotations(ctx, tx, rots); err != nil {
+		return err
+	}
+	if err := insertDecisions(ctx, tx, decs); err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
-func (r *Repository) GetPRsByReviewer(userID string) ([]model.PullRequestShort, error) {
-	rows, err := r.DB.Query(`
+func (r *Repository) AddReviewer(ctx context.Context, prID string, a Assignment, decs []model.Decision) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := lockOpenPullRequest(ctx, tx, prID); err != nil {
+		return err
+	}
+	var cnt int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(1) FROM pr_reviewers WHERE pr_id=$1 AND user_id=$2", prID, a.UserID).Scan(&cnt)
+	if err != nil {
+		return err
+	}
+	if cnt > 0 {
+		return ErrStatusConflict
+	}
+	if err := insertReviewer(ctx, tx, prID, a); err != nil {
+		return err
+	}
+	if err := insertDecisions(ctx, tx, decs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *Repository) RemoveReviewer(ctx context.Context, prID, userID string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := removeReviewer(ctx, tx, prID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// removeReviewer unassigns the user from an OPEN pull request and keeps
+// it locked for the rest of tx. It fails with ErrStatusConflict if the
+// pull request is not OPEN or the user not assigned.
+func removeReviewer(ctx context.Context, tx *sql.Tx, prID, userID string) error {
+	if err := lockOpenPullRequest(ctx, tx, prID); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM pr_reviewers WHERE pr_id=$1 AND user_id=$2", prID, userID)
+	if err != nil {
+		return err
+	}
+	if cnt, _ := res.RowsAffected(); cnt == 0 {
+		return ErrStatusConflict
+	}
+	return nil
+}
+
+// lockOpenPullRequest locks the row of an OPEN pull request for the rest
+// of tx, so its reviewers can be changed without racing a status change.
+// It fails with ErrStatusConflict if the pull request is not OPEN.
+func lockOpenPullRequest(ctx context.Context, tx *sql.Tx, prID string) error {
+	res, err := tx.ExecContext(ctx, "UPDATE pull_requests SET status=status WHERE pull_request_id=$1 AND status=$2", prID, model.StatusOpen)
+	if err != nil {
+		return err
+	}
+	cnt, _ := res.RowsAffected()
+	if cnt == 0 {
+		return ErrStatusConflict
+	}
+	return nil
+}
+
+func (r *Repository) GetPRsByReviewer(ctx context.Context, userID string) ([]model.PullRequestShort, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	rows, err := r.DB.QueryContext(ctx, `
 SELECT pr.pull_request_id, pr.pull_request_name, pr.author_id, pr.status
 FROM pull_requests pr
 JOIN pr_reviewers rr ON rr.pr_id = pr.pull_request_id
-WHERE rr.user_id = $1
+WHERE rr.user_id = $1 AND pr.status <> 'CLOSED'
 ORDER BY pr.created_at DESC`, userID)
 	if err != nil {
 		return nil, err
@@ -251,25 +962,223 @@ ORDER BY pr.created_at DESC`, userID)
 	return res, nil
 }
 
-func (r *Repository) AddUserToTeam(teamName string, u model.User) (model.Team, error) {
+func (r *Repository) GetOpenPullRequestsByReviewers(ctx context.Context, userIDs []string) ([]model.PullRequest, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res := []model.PullRequest{}
+	index := map[string]int{}
+	for _, ids := range chunks(userIDs, batchSize) {
+		rows, err := r.DB.QueryContext(ctx, `
+SELECT pr.pull_request_id, pr.pull_request_name, pr.author_id, rr.user_id
+FROM pull_requests pr
+JOIN pr_reviewers rr ON rr.pr_id = pr.pull_request_id
+WHERE pr.status = $1 AND pr.pull_request_id IN (
+  SELECT pr_id FROM pr_reviewers WHERE user_id IN (`+placeholders(2, len(ids))+`))
+ORDER BY pr.created_at, pr.pull_request_id, rr.user_id`, append([]interface{}{model.StatusOpen}, stringArgs(ids)...)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var pr model.PullRequest
+			var reviewer string
+			if err := rows.Scan(&pr.PullRequestID, &pr.PullRequestName, &pr.AuthorID, &reviewer); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			i, ok := index[pr.PullRequestID]
+			if !ok {
+				pr.Status = model.StatusOpen
+				pr.AssignedReviewers = []string{}
+				i = len(res)
+				index[pr.PullRequestID] = i
+				res = append(res, pr)
+			} else if containsString(res[i].AssignedReviewers, reviewer) {
+				continue
+			}
+			res[i].AssignedReviewers = append(res[i].AssignedReviewers, reviewer)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	prIDs := make([]string, len(res))
+	for i, pr := range res {
+		prIDs[i] = pr.PullRequestID
+	}
+	files, err := r.pullRequestFiles(ctx, prIDs)
+	if err != nil {
+		return nil, err
+	}
+	declines, err := r.pullRequestDeclines(ctx, prIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range res {
+		res[i].Files = files[res[i].PullRequestID]
+		res[i].Declines = declines[res[i].PullRequestID]
+	}
+	return res, nil
+}
+
+// pullRequestFiles returns the changed paths of each pull request, in
+// path order. Pull requests without files are absent.
+func (r *Repository) pullRequestFiles(ctx context.Context, prIDs []string) (map[string][]string, error) {
+	res := map[string][]string{}
+	for _, ids := range chunks(prIDs, batchSize) {
+		rows, err := r.DB.QueryContext(ctx, `SELECT pr_id, path FROM pull_request_files
+WHERE pr_id IN (`+placeholders(1, len(ids))+`) ORDER BY pr_id, path`, stringArgs(ids)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var prID, path string
+			if err := rows.Scan(&prID, &path); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			res[prID] = append(res[prID], path)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// pullRequestDeclines returns who declined each pull request, in the
+// order they declined. Pull requests nobody declined are absent.
+func (r *Repository) pullRequestDeclines(ctx context.Context, prIDs []string) (map[string][]model.Decline, error) {
+	res := map[string][]model.Decline{}
+	for _, ids := range chunks(prIDs, batchSize) {
+		rows, err := r.DB.QueryContext(ctx, `SELECT pr_id, user_id, reason, declined_at FROM review_declines
+WHERE pr_id IN (`+placeholders(1, len(ids))+`) ORDER BY pr_id, declined_at, user_id`, stringArgs(ids)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var prID string
+			var d model.Decline
+			var declinedAt time.Time
+			if err := rows.Scan(&prID, &d.UserID, &d.Reason, &declinedAt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			d.DeclinedAt = &declinedAt
+			res[prID] = append(res[prID], d)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (r *Repository) CountOpenReviews(ctx context.Context, userIDs []string) (map[string]int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res := map[string]int{}
+	for _, ids := range chunks(userIDs, batchSize) {
+		rows, err := r.DB.QueryContext(ctx, `
+SELECT rr.user_id, COUNT(1)
+FROM pr_reviewers rr
+JOIN pull_requests pr ON pr.pull_request_id = rr.pr_id
+WHERE pr.status = 'OPEN' AND rr.user_id IN (`+placeholders(1, len(ids))+`)
+GROUP BY rr.user_id`, stringArgs(ids)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var uid string
+			var cnt int
+			if err := rows.Scan(&uid, &cnt); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			res[uid] = cnt
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (r *Repository) CountRecentReviews(ctx context.Context, limits map[string]int) (map[string]map[string]int, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res := map[string]map[string]int{}
+	authors := []string{}
+	maxLimit := 0
+	for author, limit := range limits {
+		res[author] = map[string]int{}
+		if limit > 0 {
+			authors = append(authors, author)
+			maxLimit = max(maxLimit, limit)
+		}
+	}
+	sort.Strings(authors)
+	// The latest maxLimit pull requests of every author are numbered
+	// in one query; each author's own limit is applied below.
+	for _, ids := range chunks(authors, batchSize) {
+		rows, err := r.DB.QueryContext(ctx, `
+SELECT p.author_id, p.n, rr.user_id
+FROM (
+  SELECT pull_request_id, author_id,
+    ROW_NUMBER() OVER (PARTITION BY author_id ORDER BY created_at DESC, pull_request_id DESC) AS n
+  FROM pull_requests WHERE author_id IN (`+placeholders(1, len(ids))+`)
+) p
+JOIN pr_reviewers rr ON rr.pr_id = p.pull_request_id
+WHERE p.n <= `+placeholders(len(ids)+1, 1), append(stringArgs(ids), maxLimit)...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var author, uid string
+			var n int
+			if err := rows.Scan(&author, &n, &uid); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if n <= limits[author] {
+				res[author][uid]++
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (r *Repository) AddUserToTeam(ctx context.Context, teamName string, u model.User) (model.Team, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
 	var exists int
-	err := r.DB.QueryRow("SELECT COUNT(1) FROM users WHERE user_id=$1", u.UserID).Scan(&exists)
+	err := r.DB.QueryRowContext(ctx, "SELECT COUNT(1) FROM users WHERE user_id=$1", u.UserID).Scan(&exists)
 	if err != nil {
 		return model.Team{}, err
 	}
 	if exists > 0 {
 		return model.Team{}, fmt.Errorf("user_id %s already exists", u.UserID)
 	}
-	_, err = r.DB.Exec(`INSERT INTO users(user_id, username, team_name, is_active) VALUES($1,$2,$3,$4)`,
-		u.UserID, u.Username, teamName, u.IsActive)
+	_, err = r.DB.ExecContext(ctx, `INSERT INTO users(user_id, username, team_name, is_active, max_open_reviews, weight, tier)
+VALUES($1,$2,$3,$4,$5,$6,$7)`,
+		u.UserID, u.Username, teamName, u.IsActive, nullInt(u.MaxOpenReviews), u.Weight, nullString(u.Tier))
 	if err != nil {
 		return model.Team{}, err
 	}
-	return r.GetTeam(teamName)
+	return r.GetTeam(ctx, teamName)
 }
 
-func (r *Repository) RemoveUserFromTeam(teamName, userID string) (model.Team, error) {
-	res, err := r.DB.Exec("DELETE FROM users WHERE user_id=$1 AND team_name=$2", userID, teamName)
+func (r *Repository) RemoveUserFromTeam(ctx context.Context, teamName, userID string) (model.Team, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	res, err := r.DB.ExecContext(ctx, "DELETE FROM users WHERE user_id=$1 AND team_name=$2", userID, teamName)
 	if err != nil {
 		return model.Team{}, err
 	}
@@ -277,5 +1186,75 @@ func (r *Repository) RemoveUserFromTeam(teamName, userID string) (model.Team, er
 	if cnt == 0 {
 		return model.Team{}, fmt.Errorf("user_id %s not found in team %s", userID, teamName)
 	}
-	return r.GetTeam(teamName)
+	return r.GetTeam(ctx, teamName)
+}
+
+// batchSize bounds the number of arguments of one IN list.
+const batchSize = 500
+
+func chunks(ss []string, size int) [][]string {
+	res := [][]string{}
+	for len(ss) > size {
+		res = append(res, ss[:size])
+		ss = ss[size:]
+	}
+	if len(ss) > 0 {
+		res = append(res, ss)
+	}
+	return res
+}
+
+func containsString(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// placeholders returns "$from, $from+1, ..." for n arguments. It is used
+// instead of array parameters, which SQLite does not have. SQLite numbers
+// $N parameters in order of appearance, so they must appear in the query
+// text in increasing order.
+func placeholders(from, n int) string {
+	ps := make([]string, n)
+	for i := range ps {
+		ps[i] = fmt.Sprintf("$%d", from+i)
+	}
+	return strings.Join(ps, ", ")
+}
+
+func stringArgs(ss []string) []interface{} {
+	args := make([]interface{}, len(ss))
+	for i, s := range ss {
+		args[i] = s
+	}
+	return args
+}
+
+// now is the current time as unavailability periods are stored: UTC,
+// whole seconds. SQLite compares timestamps as text, which only works
+// when both sides have the same format.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	v := t.Time
+	return &v
+}
+
+func nullInt(n *int) sql.NullInt64 {
+	if n == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*n), Valid: true}
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
 }
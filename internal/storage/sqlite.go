@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// NewSQLiteDBFromEnv opens the SQLite database file named by DB_PATH.
+// Foreign keys are switched on and transactions take the write lock up
+// front, so concurrent writers wait for each other instead of failing.
+func NewSQLiteDBFromEnv() (*sql.DB, error) {
+	path := getEnv("DB_PATH", "prdb.sqlite")
+
+	dsn := fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate", path)
+
+	return sql.Open("sqlite3", dsn)
+}
+
+// NewSQLiteRepository returns a Repository that runs its queries against
+// SQLite. The schema comes from internal/migrations/sqlite.
+func NewSQLiteRepository(db *sql.DB) *Repository {
+	return &Repository{DB: db}
+}
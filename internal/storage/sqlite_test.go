@@ -0,0 +1,32 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/migrations"
+	"github.com/ilya2044/avito2025/internal/storage"
+)
+
+func TestSQLiteRepository(t *testing.T) {
+	testStore(t, func(t *testing.T) storage.Store {
+		path := filepath.Join(t.TempDir(), "test.sqlite")
+		db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate", path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo := storage.NewSQLiteRepository(db)
+		t.Cleanup(func() { repo.Close() })
+		runner, err := migrations.NewRunner(db, migrations.SQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := runner.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	})
+}
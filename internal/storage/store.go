@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ilya2044/avito2025/internal/model"
+)
+
+// Store is the persistence layer used by the service. Repository is the
+// SQL implementation for Postgres and SQLite, MemoryStore keeps data in
+// process memory.
+type Store interface {
+	CreateTeam(ctx context.Context, team model.Team) error
+	GetTeam(ctx context.Context, teamName string) (model.Team, error)
+	AddUserToTeam(ctx context.Context, teamName string, u model.User) (model.Team, error)
+	RemoveUserFromTeam(ctx context.Context, teamName, userID string) (model.Team, error)
+	GetTeamSettings(ctx context.Context, teamName string) (model.TeamSettings, error)
+	UpdateTeamSettings(ctx context.Context, teamName string, s model.TeamSettings) error
+	// GetRotationCursor returns the user_id the team's round-robin
+	// rotation stopped at, or "" if it has not started.
+	GetRotationCursor(ctx context.Context, teamName string) (string, error)
+
+	GetUser(ctx context.Context, userID string) (model.User, error)
+	// GetUsers returns the users that exist out of userIDs.
+	GetUsers(ctx context.Context, userIDs []string) ([]model.User, error)
+	SetUserIsActive(ctx context.Context, userID string, isActive bool) (model.User, error)
+	// SetUserCapacity sets the user's max_open_reviews; nil removes the
+	// limit.
+	SetUserCapacity(ctx context.Context, userID string, limit *int) (model.User, error)
+	// SetUserProfile sets the user's assignment weight and tier; an
+	// empty tier removes it.
+	SetUserProfile(ctx context.Context, userID string, weight float64, tier string) (model.User, error)
+	// DeactivateUsers marks the users inactive and hands their reviews
+	// over as listed, in one transaction. It fails with
+	// ErrStatusConflict if a pull request is no longer OPEN or the old
+	// reviewer is no longer assigned to it.
+	DeactivateUsers(ctx context.Context, userIDs []string, repls []Replacement, rots []Rotation, decs []model.Decision) error
+	// GetActiveTeamMembers leaves out inactive users and users inside an
+	// unavailability period.
+	GetActiveTeamMembers(ctx context.Context, teamName string, exclude []string) ([]model.User, error)
+	AddUnavailability(ctx context.Context, u model.Unavailability) (model.Unavailability, error)
+	// ListUnavailability returns the user's periods that have not ended,
+	// by start time.
+	ListUnavailability(ctx context.Context, userID string) ([]model.Unavailability, error)
+	// RemoveUnavailability returns sql.ErrNoRows if the user has no
+	// period with this id.
+	RemoveUnavailability(ctx context.Context, userID string, id int64) error
+
+	// CreatePullRequest and ReplaceReviewer advance the rotations and
+	// record the decisions in the same transaction and fail with
+	// ErrRotationConflict if a cursor has moved since it was read.
+	// CreatePullRequest stores pr.Status, OPEN if it is empty.
+	CreatePullRequest(ctx context.Context, pr model.PullRequest, assigned []Assignment, rots []Rotation, decs []model.Decision) error
+	GetPullRequest(ctx context.Context, prID string) (model.PullRequest, error)
+	// MergePullRequest merges an OPEN pull request and returns a MERGED
+	// one unchanged. Other statuses give ErrStatusConflict. A non-nil
+	// check is run on the reviews while the pull request is locked, and
+	// its error stops the merge.
+	MergePullRequest(ctx context.Context, prID string, check func([]model.Review) error) (model.PullRequest, error)
+	// SetPullRequestStatus moves a pull request from status from to to,
+	// adding the assigned reviewers, unassigning the removed reviewers,
+	// handing over the reviews in repls, advancing the rotations and
+	// recording the decisions in the same transaction. repls and removed
+	// are only allowed when moving to OPEN. It fails with
+	// ErrStatusConflict if the status is no longer from or a reviewer to
+	// replace or remove is no longer assigned.
+	SetPullRequestStatus(ctx context.Context, prID, from, to string, assigned []Assignment, repls []Replacement, removed []string, rots []Rotation, decs []model.Decision) error
+
+	IsUserAssignedToPR(ctx context.Context, prID, userID string) (bool, error)
+	// ReplaceReviewer fails with ErrStatusConflict if the pull request
+	// is no longer OPEN or oldUserID no longer assigned to it.
+	ReplaceReviewer(ctx context.Context, prID, oldUserID string, repl Assignment, rots []Rotation, decs []model.Decision) error
+	// DeclineReview records that the user declined the pull request and
+	// replaces them with repl in the same transaction, or just unassigns
+	// them if repl is nil. It fails with ErrStatusConflict if the pull
+	// request is no longer OPEN or the user no longer assigned. A later
+	// decline by the same user replaces the earlier one.
+	DeclineReview(ctx context.Context, prID string, d model.Decline, repl *Assignment, rots []Rotation, decs []model.Decision) error
+	// AddReviewer assigns the user to the pull request and records the
+	// decisions in the same transaction. RemoveReviewer unassigns them.
+	// Both fail with ErrStatusConflict if the pull request is no longer
+	// OPEN, or the user already assigned or no longer assigned.
+	AddReviewer(ctx context.Context, prID string, a Assignment, decs []model.Decision) error
+	RemoveReviewer(ctx context.Context, prID, userID string) error
+	// ListDecisions returns the recorded assignment decisions of the pull
+	// request, oldest first.
+	ListDecisions(ctx context.Context, prID string) ([]model.Decision, error)
+	// SetReviewState records a reviewer's decision. A COMMENTED review
+	// after APPROVED or CHANGES_REQUESTED keeps that state and only
+	// replaces the comment. It returns sql.ErrNoRows if the user is not
+	// assigned to the pull request and ErrStatusConflict if the pull
+	// request is no longer OPEN.
+	SetReviewState(ctx context.Context, prID, userID, state, comment string) error
+	// GetPRsByReviewer leaves out CLOSED pull requests.
+	GetPRsByReviewer(ctx context.Context, userID string) ([]model.PullRequestShort, error)
+	// GetOpenPullRequestsByReviewers returns the OPEN pull requests any of
+	// the users reviews. Only the ids, name, author, status, files,
+	// declines and assigned reviewers are filled in.
+	GetOpenPullRequestsByReviewers(ctx context.Context, userIDs []string) ([]model.PullRequest, error)
+	// CountOpenReviews returns how many OPEN pull requests each of the
+	// given users reviews. Users without open reviews are absent.
+	CountOpenReviews(ctx context.Context, userIDs []string) (map[string]int, error)
+	// CountRecentReviews returns for every author in limits how many of
+	// their latest limits[author] pull requests each reviewer was
+	// assigned to. Reviewers of none of them are absent.
+	CountRecentReviews(ctx context.Context, limits map[string]int) (map[string]map[string]int, error)
+
+	Close() error
+}
+
+var _ Store = (*Repository)(nil)
+
+var ErrRotationConflict = errors.New("rotation cursor was moved concurrently")
+
+var ErrStatusConflict = errors.New("pull request status was changed concurrently")
+
+// Assignment is a reviewer picked for a pull request.
+type Assignment struct {
+	UserID string
+	// FallbackTeam is set when the reviewer was drawn from a fallback
+	// team because the primary team had nobody eligible left.
+	FallbackTeam string
+}
+
+// Replacement hands OldUserID's review of a pull request to New.
+type Replacement struct {
+	PullRequestID string
+	OldUserID     string
+	New           Assignment
+}
+
+// Rotation moves a team's round-robin cursor from From to To.
+type Rotation struct {
+	Team string
+	From string
+	To   string
+}
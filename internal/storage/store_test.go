@@ -0,0 +1,374 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/ilya2044/avito2025/internal/model"
+	"github.com/ilya2044/avito2025/internal/storage"
+)
+
+// testStore runs the behaviour every Store must share against stores
+// made by open, a fresh one for every subtest.
+func testStore(t *testing.T, open func(t *testing.T) storage.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, st storage.Store)
+	}{
+		{"DuplicateTeam", testDuplicateTeam},
+		{"DuplicateUser", testDuplicateUser},
+		{"NotFound", testNotFound},
+		{"Merge", testMerge},
+		{"StatusConflicts", testStatusConflicts},
+		{"ReviewerConflicts", testReviewerConflicts},
+		{"RotationConflict", testRotationConflict},
+		{"ReopenChangesReviewers", testReopenChangesReviewers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+func member(id string) model.TeamMember {
+	return model.TeamMember{UserID: id, Username: id, IsActive: true, Weight: model.DefaultWeight}
+}
+
+func mustCreateTeam(t *testing.T, st storage.Store, name string, ids ...string) {
+	t.Helper()
+	team := model.Team{TeamName: name, Members: []model.TeamMember{}}
+	for _, id := range ids {
+		team.Members = append(team.Members, member(id))
+	}
+	if err := st.CreateTeam(context.Background(), team); err != nil {
+		t.Fatalf("create team %s: %v", name, err)
+	}
+}
+
+// mustCreatePR creates an OPEN pull request by a with the reviewers.
+func mustCreatePR(t *testing.T, st storage.Store, prID string, reviewers ...string) {
+	t.Helper()
+	assigned := []storage.Assignment{}
+	for _, id := range reviewers {
+		assigned = append(assigned, storage.Assignment{UserID: id})
+	}
+	pr := model.PullRequest{PullRequestID: prID, PullRequestName: prID, AuthorID: "a"}
+	if err := st.CreatePullRequest(context.Background(), pr, assigned, nil, nil); err != nil {
+		t.Fatalf("create %s: %v", prID, err)
+	}
+}
+
+func mustGetPR(t *testing.T, st storage.Store, prID string) model.PullRequest {
+	t.Helper()
+	pr, err := st.GetPullRequest(context.Background(), prID)
+	if err != nil {
+		t.Fatalf("get %s: %v", prID, err)
+	}
+	return pr
+}
+
+func testDuplicateTeam(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	mustCreateTeam(t, st, "backend", "u1")
+	if err := st.CreateTeam(ctx, model.Team{TeamName: "backend", Members: []model.TeamMember{member("u2")}}); err == nil {
+		t.Fatal("second team backend: want an error")
+	}
+	if _, err := st.GetUser(ctx, "u2"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("u2 of the rejected team: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testDuplicateUser(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	mustCreateTeam(t, st, "backend", "u1")
+	// A user_id taken by another team.
+	if err := st.CreateTeam(ctx, model.Team{TeamName: "frontend", Members: []model.TeamMember{member("u2"), member("u1")}}); err == nil {
+		t.Fatal("u1 in a second team: want an error")
+	}
+	// A user_id listed twice in the same team.
+	if err := st.CreateTeam(ctx, model.Team{TeamName: "frontend", Members: []model.TeamMember{member("u3"), member("u3")}}); err == nil {
+		t.Fatal("u3 twice: want an error")
+	}
+	// Nothing of the rejected teams is left behind.
+	for _, id := range []string{"u2", "u3"} {
+		if _, err := st.GetUser(ctx, id); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("%s: err = %v, want sql.ErrNoRows", id, err)
+		}
+	}
+	if _, err := st.GetTeamSettings(ctx, "frontend"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("frontend settings: err = %v, want sql.ErrNoRows", err)
+	}
+	u, err := st.GetUser(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.TeamName != "backend" {
+		t.Errorf("u1 team = %s, want backend", u.TeamName)
+	}
+	if _, err := st.AddUserToTeam(ctx, "backend", model.User{UserID: "u1", Username: "u1", IsActive: true, Weight: model.DefaultWeight}); err == nil {
+		t.Error("adding u1 again: want an error")
+	}
+}
+
+func testNotFound(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	mustCreateTeam(t, st, "backend", "a", "u1")
+	if _, err := st.GetUser(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUser: err = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := st.GetTeamSettings(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetTeamSettings: err = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := st.GetPullRequest(ctx, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetPullRequest: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := st.RemoveUnavailability(ctx, "u1", 1); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("RemoveUnavailability: err = %v, want sql.ErrNoRows", err)
+	}
+	mustCreatePR(t, st, "pr-1", "u1")
+	if err := st.SetReviewState(ctx, "pr-1", "a", model.ReviewApproved, ""); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("SetReviewState of a non-reviewer: err = %v, want sql.ErrNoRows", err)
+	}
+	users, err := st.GetUsers(ctx, []string{"u1", "nobody"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].UserID != "u1" {
+		t.Errorf("GetUsers = %+v, want only u1", users)
+	}
+}
+
+func testMerge(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	mustCreateTeam(t, st, "backend", "a", "u1")
+	mustCreatePR(t, st, "pr-1", "u1")
+
+	stop := errors.New("not approved")
+	if _, err := st.MergePullRequest(ctx, "pr-1", func([]model.Review) error { return stop }); !errors.Is(err, stop) {
+		t.Fatalf("failing check: err = %v, want its error", err)
+	}
+	if pr := mustGetPR(t, st, "pr-1"); pr.Status != model.StatusOpen {
+		t.Fatalf("status after a failed check = %s, want OPEN", pr.Status)
+	}
+
+	var seen []model.Review
+	merged, err := st.MergePullRequest(ctx, "pr-1", func(reviews []model.Review) error {
+		seen = reviews
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 1 || seen[0].UserID != "u1" || seen[0].State != model.ReviewPending {
+		t.Errorf("check saw reviews %+v, want u1 PENDING", seen)
+	}
+	if merged.Status != model.StatusMerged || merged.MergedAt == nil {
+		t.Fatalf("merged: status %s, mergedAt %v", merged.Status, merged.MergedAt)
+	}
+
+	// Merging again neither runs the check nor moves mergedAt.
+	again, err := st.MergePullRequest(ctx, "pr-1", func([]model.Review) error { return stop })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Status != model.StatusMerged || !again.MergedAt.Equal(*merged.MergedAt) {
+		t.Errorf("second merge: status %s, mergedAt %v, want %v", again.Status, again.MergedAt, merged.MergedAt)
+	}
+
+	if _, err := st.MergePullRequest(ctx, "nobody", nil); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("unknown pull request: err = %v, want sql.ErrNoRows", err)
+	}
+	mustCreatePR(t, st, "pr-2", "u1")
+	if err := st.SetPullRequestStatus(ctx, "pr-2", model.StatusOpen, model.StatusClosed, nil, nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.MergePullRequest(ctx, "pr-2", nil); !errors.Is(err, storage.ErrStatusConflict) {
+		t.Errorf("closed pull request: err = %v, want ErrStatusConflict", err)
+	}
+}
+
+// testStatusConflicts expects every change to the reviewers of a pull
+// request that is not OPEN to fail and leave it as it was.
+func testStatusConflicts(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	mustCreateTeam(t, st, "backend", "a", "u1", "u2")
+	mustCreatePR(t, st, "pr-1", "u1")
+	if _, err := st.MergePullRequest(ctx, "pr-1", nil); err != nil {
+		t.Fatal(err)
+	}
+	mustCreatePR(t, st, "pr-2", "u1")
+	if err := st.SetPullRequestStatus(ctx, "pr-2", model.StatusOpen, model.StatusClosed, nil, nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, prID := range []string{"pr-1", "pr-2"} {
+		calls := map[string]error{
+			"ReplaceReviewer": st.ReplaceReviewer(ctx, prID, "u1", storage.Assignment{UserID: "u2"}, nil, nil),
+			"DeclineReview":   st.DeclineReview(ctx, prID, model.Decline{UserID: "u1", Reason: "busy"}, nil, nil, nil),
+			"AddReviewer":     st.AddReviewer(ctx, prID, storage.Assignment{UserID: "u2"}, nil),
+			"RemoveReviewer":  st.RemoveReviewer(ctx, prID, "u1"),
+			"SetReviewState":  st.SetReviewState(ctx, prID, "u1", model.ReviewApproved, ""),
+			"DeactivateUsers": st.DeactivateUsers(ctx, []string{"u1"}, []storage.Replacement{{PullRequestID: prID, OldUserID: "u1", New: storage.Assignment{UserID: "u2"}}}, nil, nil),
+		}
+		for name, err := range calls {
+			if !errors.Is(err, storage.ErrStatusConflict) {
+				t.Errorf("%s on %s: err = %v, want ErrStatusConflict", name, prID, err)
+			}
+		}
+		pr := mustGetPR(t, st, prID)
+		if len(pr.AssignedReviewers) != 1 || pr.AssignedReviewers[0] != "u1" || len(pr.Declines) != 0 {
+			t.Errorf("%s: reviewers %v, declines %+v, want u1 and no declines", prID, pr.AssignedReviewers, pr.Declines)
+		}
+		if pr.Reviews[0].State != model.ReviewPending {
+			t.Errorf("%s: review state %s, want PENDING", prID, pr.Reviews[0].State)
+		}
+	}
+	u1, err := st.GetUser(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u1.IsActive {
+		t.Error("u1 was deactivated by a failed DeactivateUsers")
+	}
+
+	// A status change expecting another status than the current one.
+	if err := st.SetPullRequestStatus(ctx, "pr-2", model.StatusDraft, model.StatusOpen, nil, nil, nil, nil, nil); !errors.Is(err, storage.ErrStatusConflict) {
+		t.Errorf("SetPullRequestStatus from DRAFT: err = %v, want ErrStatusConflict", err)
+	}
+	if pr := mustGetPR(t, st, "pr-2"); pr.Status != model.StatusClosed {
+		t.Errorf("pr-2 status = %s, want CLOSED", pr.Status)
+	}
+	if err := st.SetPullRequestStatus(ctx, "pr-2", model.StatusClosed, model.StatusOpen, nil, nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if pr := mustGetPR(t, st, "pr-2"); pr.Status != model.StatusOpen {
+		t.Errorf("pr-2 status = %s, want OPEN", pr.Status)
+	}
+}
+
+// testReviewerConflicts expects the changes to fail on an OPEN pull
+// request whose reviewers are no longer what the caller read.
+func testReviewerConflicts(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	mustCreateTeam(t, st, "backend", "a", "u1", "u2", "u3")
+	mustCreatePR(t, st, "pr-1", "u1")
+
+	calls := map[string]error{
+		"ReplaceReviewer of a non-reviewer": st.ReplaceReviewer(ctx, "pr-1", "u2", storage.Assignment{UserID: "u3"}, nil, nil),
+		"DeclineReview of a non-reviewer":   st.DeclineReview(ctx, "pr-1", model.Decline{UserID: "u2"}, nil, nil, nil),
+		"AddReviewer of a reviewer":         st.AddReviewer(ctx, "pr-1", storage.Assignment{UserID: "u1"}, nil),
+		"RemoveReviewer of a non-reviewer":  st.RemoveReviewer(ctx, "pr-1", "u2"),
+	}
+	for name, err := range calls {
+		if !errors.Is(err, storage.ErrStatusConflict) {
+			t.Errorf("%s: err = %v, want ErrStatusConflict", name, err)
+		}
+	}
+
+	if err := st.ReplaceReviewer(ctx, "pr-1", "u1", storage.Assignment{UserID: "u2", FallbackTeam: "infra"}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	pr := mustGetPR(t, st, "pr-1")
+	if len(pr.AssignedReviewers) != 1 || pr.AssignedReviewers[0] != "u2" {
+		t.Fatalf("reviewers = %v, want [u2]", pr.AssignedReviewers)
+	}
+	if len(pr.FallbackReviewers) != 1 || pr.FallbackReviewers[0].UserID != "u2" || pr.FallbackReviewers[0].TeamName != "infra" {
+		t.Errorf("fallback = %+v, want u2 from infra", pr.FallbackReviewers)
+	}
+	// The replaced reviewer cannot be replaced a second time.
+	if err := st.ReplaceReviewer(ctx, "pr-1", "u1", storage.Assignment{UserID: "u3"}, nil, nil); !errors.Is(err, storage.ErrStatusConflict) {
+		t.Errorf("second replacement of u1: err = %v, want ErrStatusConflict", err)
+	}
+
+	if err := st.DeclineReview(ctx, "pr-1", model.Decline{UserID: "u2", Reason: "busy"}, &storage.Assignment{UserID: "u3"}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	pr = mustGetPR(t, st, "pr-1")
+	if len(pr.AssignedReviewers) != 1 || pr.AssignedReviewers[0] != "u3" || len(pr.Declines) != 1 || pr.Declines[0].UserID != "u2" {
+		t.Errorf("after decline: reviewers %v, declines %+v", pr.AssignedReviewers, pr.Declines)
+	}
+}
+
+// testRotationConflict expects a write to fail as a whole when a
+// round-robin cursor is no longer where the caller read it.
+func testRotationConflict(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	mustCreateTeam(t, st, "backend", "a", "u1", "u2", "u3")
+	pr := model.PullRequest{PullRequestID: "pr-1", PullRequestName: "x", AuthorID: "a"}
+	assigned := []storage.Assignment{{UserID: "u1"}}
+
+	stale := []storage.Rotation{{Team: "backend", From: "u3", To: "u1"}}
+	if err := st.CreatePullRequest(ctx, pr, assigned, stale, nil); !errors.Is(err, storage.ErrRotationConflict) {
+		t.Fatalf("stale cursor: err = %v, want ErrRotationConflict", err)
+	}
+	if _, err := st.GetPullRequest(ctx, "pr-1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("pull request of a failed create: err = %v, want sql.ErrNoRows", err)
+	}
+
+	if err := st.CreatePullRequest(ctx, pr, assigned, []storage.Rotation{{Team: "backend", From: "", To: "u1"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := st.GetRotationCursor(ctx, "backend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor != "u1" {
+		t.Fatalf("cursor = %q, want u1", cursor)
+	}
+
+	// A second writer that read the cursor before the first moved it.
+	if err := st.ReplaceReviewer(ctx, "pr-1", "u1", storage.Assignment{UserID: "u2"}, []storage.Rotation{{Team: "backend", From: "", To: "u2"}}, nil); !errors.Is(err, storage.ErrRotationConflict) {
+		t.Fatalf("replace with a stale cursor: err = %v, want ErrRotationConflict", err)
+	}
+	got := mustGetPR(t, st, "pr-1")
+	if len(got.AssignedReviewers) != 1 || got.AssignedReviewers[0] != "u1" {
+		t.Errorf("reviewers after the failed replace = %v, want [u1]", got.AssignedReviewers)
+	}
+	if cursor, _ := st.GetRotationCursor(ctx, "backend"); cursor != "u1" {
+		t.Errorf("cursor after the failed replace = %q, want u1", cursor)
+	}
+
+	if err := st.ReplaceReviewer(ctx, "pr-1", "u1", storage.Assignment{UserID: "u2"}, []storage.Rotation{{Team: "backend", From: "u1", To: "u2"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cursor, _ := st.GetRotationCursor(ctx, "backend"); cursor != "u2" {
+		t.Errorf("cursor = %q, want u2", cursor)
+	}
+}
+
+// testReopenChangesReviewers expects reviewers to be replaced and removed
+// together with moving a pull request back to OPEN, and not otherwise.
+func testReopenChangesReviewers(t *testing.T, st storage.Store) {
+	ctx := context.Background()
+	mustCreateTeam(t, st, "backend", "a", "u1", "u2", "u3")
+	mustCreatePR(t, st, "pr-1", "u1", "u2")
+	if err := st.SetPullRequestStatus(ctx, "pr-1", model.StatusOpen, model.StatusClosed, nil, nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	repls := []storage.Replacement{{PullRequestID: "pr-1", OldUserID: "u1", New: storage.Assignment{UserID: "u3"}}}
+
+	if err := st.SetPullRequestStatus(ctx, "pr-1", model.StatusClosed, model.StatusOpen, nil, nil, []string{"u3"}, nil, nil); !errors.Is(err, storage.ErrStatusConflict) {
+		t.Errorf("removing a non-reviewer: err = %v, want ErrStatusConflict", err)
+	}
+	if err := st.SetPullRequestStatus(ctx, "pr-1", model.StatusClosed, model.StatusOpen, nil, repls, []string{"u1"}, nil, nil); !errors.Is(err, storage.ErrStatusConflict) {
+		t.Errorf("replacing a removed reviewer: err = %v, want ErrStatusConflict", err)
+	}
+	if err := st.SetPullRequestStatus(ctx, "pr-1", model.StatusClosed, model.StatusDraft, nil, repls, nil, nil, nil); !errors.Is(err, storage.ErrStatusConflict) {
+		t.Errorf("replacing while not moving to OPEN: err = %v, want ErrStatusConflict", err)
+	}
+	pr := mustGetPR(t, st, "pr-1")
+	if pr.Status != model.StatusClosed || len(pr.AssignedReviewers) != 2 {
+		t.Fatalf("after the failed changes: status %s, reviewers %v", pr.Status, pr.AssignedReviewers)
+	}
+
+	if err := st.SetPullRequestStatus(ctx, "pr-1", model.StatusClosed, model.StatusOpen, nil, repls, []string{"u2"}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	pr = mustGetPR(t, st, "pr-1")
+	if pr.Status != model.StatusOpen || len(pr.AssignedReviewers) != 1 || pr.AssignedReviewers[0] != "u3" {
+		t.Errorf("reopened: status %s, reviewers %v, want only u3", pr.Status, pr.AssignedReviewers)
+	}
+}